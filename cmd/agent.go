@@ -0,0 +1,167 @@
+// agent.go
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/spf13/pflag"
+)
+
+// The flags of the commands that chat with an agent, added by addAgentFlags.
+const (
+	agentURLFlag         = "url"
+	agentTokenFlag       = "token"
+	agentPrivateKeyFlag  = "private-key"
+	agentTimeoutFlag     = "timeout"
+	agentIdleTimeoutFlag = "idle-timeout"
+	agentSSEModeFlag     = "sse-mode"
+	agentRulesFlag       = "rules"
+	agentReferencesFlag  = "reference-schemas"
+	agentRedactFlag      = "redact"
+)
+
+// agentFlags are how to reach an agent and check its responses, as set by the
+// flags added by addAgentFlags.
+type agentFlags struct {
+	URL         string
+	Token       string
+	Signer      chat.Signer
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+	ParseMode   chat.ParseMode
+	Rules       *chat.RuleSet
+	Redactor    *chat.Redactor
+}
+
+// addAgentFlags adds the flags shared by the commands that chat with an agent.
+func addAgentFlags(flags *pflag.FlagSet) {
+	addConnectionFlags(flags)
+	addTimeoutFlags(flags)
+	flags.String(agentSSEModeFlag, "lenient", "How closely agent responses must follow what Copilot clients expect. Supported modes are `lenient`, `strict`. `lenient` accepts any stream valid per the SSE spec and warns about what Copilot ignores. `strict` rejects anything beyond single line `event` and `data` fields.")
+	flags.String(agentRulesFlag, "", "Path to a JSON file overriding the severity of protocol rules, e.g. {\"rules\": {\"reference.missing-display-name\": \"off\"}}")
+	flags.String(agentReferencesFlag, "", "Path to a JSON file with the schemas of the data of custom reference types, e.g. {\"types\": {\"acme.ticket\": {\"type\": \"object\", \"required\": [\"key\"]}}}")
+}
+
+// parseAgentFlags reads the flags added by addAgentFlags, loading the private
+// key and the rule and reference schema files they point to.
+func parseAgentFlags(flags *pflag.FlagSet) (agentFlags, error) {
+	f, err := parseConnectionFlags(flags)
+	if err != nil {
+		return f, err
+	}
+
+	f.Timeout, f.IdleTimeout = parseTimeoutFlags(flags)
+
+	sseMode, _ := flags.GetString(agentSSEModeFlag)
+	f.ParseMode = chat.ParseMode(strings.ToLower(sseMode))
+	if f.ParseMode != chat.ParseModeLenient && f.ParseMode != chat.ParseModeStrict {
+		return f, fmt.Errorf("sse mode must be either `lenient` or `strict`")
+	}
+
+	f.Rules = chat.NewRuleSet()
+	if path, _ := flags.GetString(agentRulesFlag); path != "" {
+		rules, err := chat.LoadRuleSet(path)
+		if err != nil {
+			return f, err
+		}
+		f.Rules = rules
+	}
+	if path, _ := flags.GetString(agentReferencesFlag); path != "" {
+		if err := f.Rules.LoadReferenceTypes(path); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+// addConnectionFlags adds the flags of how to reach an agent, shared by every
+// command sending requests to one.
+func addConnectionFlags(flags *pflag.FlagSet) {
+	flags.String(agentURLFlag, "http://localhost:8080", "url to chat with your agent")
+	flags.String(agentTokenFlag, "", "GitHub token for chat authentication (optional)")
+	addSignerFlag(flags)
+	addRedactFlag(flags)
+}
+
+// parseConnectionFlags reads the flags added by addConnectionFlags, loading
+// the private key.
+func parseConnectionFlags(flags *pflag.FlagSet) (agentFlags, error) {
+	var f agentFlags
+
+	f.URL, _ = flags.GetString(agentURLFlag)
+	if f.URL == "" {
+		return f, fmt.Errorf("agent url is required")
+	}
+
+	f.Token, _ = flags.GetString(agentTokenFlag)
+
+	signer, err := parseSignerFlag(flags)
+	if err != nil {
+		return f, err
+	}
+	f.Signer = signer
+
+	redactor, err := parseRedactFlag(flags, f.Token)
+	if err != nil {
+		return f, err
+	}
+	f.Redactor = redactor
+
+	return f, nil
+}
+
+// addTimeoutFlags adds the flags limiting how long to wait for a response.
+func addTimeoutFlags(flags *pflag.FlagSet) {
+	flags.Duration(agentTimeoutFlag, 0, "Maximum time to wait for the agent to finish a response, e.g. `2m`. 0 means no limit.")
+	flags.Duration(agentIdleTimeoutFlag, time.Minute, "Cancel a response when the agent sends no data for this long. 0 means no limit.")
+}
+
+// parseTimeoutFlags reads the timeout and idle timeout flags added by
+// addTimeoutFlags.
+func parseTimeoutFlags(flags *pflag.FlagSet) (time.Duration, time.Duration) {
+	timeout, _ := flags.GetDuration(agentTimeoutFlag)
+	idleTimeout, _ := flags.GetDuration(agentIdleTimeoutFlag)
+	return timeout, idleTimeout
+}
+
+// addSignerFlag adds the flag of the private key the requests sent to an agent
+// are signed with.
+func addSignerFlag(flags *pflag.FlagSet) {
+	flags.String(agentPrivateKeyFlag, "", "Private key, or path to a private key file, used to sign the payloads sent to your agent")
+}
+
+// parseSignerFlag returns the signer of the private key passed with the flag
+// added by addSignerFlag, or nil when requests are not signed.
+func parseSignerFlag(flags *pflag.FlagSet) (chat.Signer, error) {
+	privateKey, _ := flags.GetString(agentPrivateKeyFlag)
+	if privateKey == "" {
+		return nil, nil
+	}
+	signer, err := chat.LoadKeySigner(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// addRedactFlag adds the flag of the patterns of the secrets to mask in the
+// output.
+func addRedactFlag(flags *pflag.FlagSet) {
+	flags.StringSlice(agentRedactFlag, nil, "Regular expressions matching secrets to mask in the output, in addition to the token, GitHub tokens, signatures and private keys, e.g. acme_[a-z0-9]+. Repeat the flag or separate them with commas.")
+}
+
+// parseRedactFlag returns the Redactor masking the token and the patterns
+// passed with the flag added by addRedactFlag.
+func parseRedactFlag(flags *pflag.FlagSet, token string) (*chat.Redactor, error) {
+	patterns, _ := flags.GetStringSlice(agentRedactFlag)
+	redactor, err := chat.NewRedactor(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	redactor.AddSecret(token)
+	return redactor, nil
+}
@@ -0,0 +1,92 @@
+// bench.go
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/bench"
+	"github.com/spf13/cobra"
+)
+
+const (
+	benchCmdPromptsFlag     = "prompts"
+	benchCmdScenarioFlag    = "scenario"
+	benchCmdConcurrencyFlag = "concurrency"
+	benchCmdRampUpFlag      = "ramp-up"
+	benchCmdDurationFlag    = "duration"
+	benchCmdThinkTimeFlag   = "think-time"
+)
+
+// benchCmd load tests an agent with concurrent conversations
+var benchCmd = &cobra.Command{
+	Use:               "bench --prompts [filename]",
+	Short:             "Load test your agent.",
+	Long:              `Fires concurrent conversations at your agent and reports its throughput, error rate, and first token and completion latencies.`,
+	Run:               agentBench,
+	PersistentPreRunE: setFlagsFromEnv,
+}
+
+func init() {
+	addConnectionFlags(benchCmd.PersistentFlags())
+	addTimeoutFlags(benchCmd.PersistentFlags())
+	benchCmd.PersistentFlags().String(benchCmdPromptsFlag, "", "file with one prompt per line, each sent as a conversation of its own")
+	benchCmd.PersistentFlags().String(benchCmdScenarioFlag, "", "JSON file with multi-turn conversations, e.g. {\"conversations\": [[\"hello\", \"tell me more\"]]}")
+	benchCmd.PersistentFlags().Int(benchCmdConcurrencyFlag, 1, "number of conversations in flight at the same time")
+	benchCmd.PersistentFlags().Duration(benchCmdRampUpFlag, 0, "spread the start of the concurrent conversations over this duration")
+	benchCmd.PersistentFlags().Duration(benchCmdDurationFlag, 0, "keep starting conversations until this duration has elapsed. 0 runs every conversation once per worker.")
+	benchCmd.PersistentFlags().Duration(benchCmdThinkTimeFlag, 0, "pause between two turns of the same conversation")
+}
+
+func agentBench(cmd *cobra.Command, args []string) {
+	agent, err := parseConnectionFlags(cmd.Flags())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	timeout, idleTimeout := parseTimeoutFlags(cmd.Flags())
+	prompts, _ := cmd.Flags().GetString(benchCmdPromptsFlag)
+	scenario, _ := cmd.Flags().GetString(benchCmdScenarioFlag)
+	concurrency, _ := cmd.Flags().GetInt(benchCmdConcurrencyFlag)
+	rampUp, _ := cmd.Flags().GetDuration(benchCmdRampUpFlag)
+	duration, _ := cmd.Flags().GetDuration(benchCmdDurationFlag)
+	thinkTime, _ := cmd.Flags().GetDuration(benchCmdThinkTimeFlag)
+
+	var conversations [][]string
+	switch {
+	case scenario != "":
+		conversations, err = bench.LoadScenario(scenario)
+	case prompts != "":
+		conversations, err = bench.LoadPrompts(prompts)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: --prompts [file] or --scenario [file] is required")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading prompts: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Running %d concurrent conversations against %s...\n\n", concurrency, agent.Redactor.String(agent.URL))
+
+	report, err := bench.Run(context.Background(), bench.Options{
+		URL:           agent.URL,
+		Token:         agent.Token,
+		Conversations: conversations,
+		Concurrency:   concurrency,
+		RampUp:        rampUp,
+		Duration:      duration,
+		ThinkTime:     thinkTime,
+		Timeout:       timeout,
+		IdleTimeout:   idleTimeout,
+		Signer:        agent.Signer,
+		Redactor:      agent.Redactor,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(report)
+}
@@ -1,77 +1,172 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
 	"github.com/spf13/cobra"
-	"github.com/spf13/pflag"
 )
 
 const (
-	chatCmdURLFlag        = "url"
-	chatCmdUsernameFlag   = "username"
-	chatCmdLogLevelFlag   = "log-level"
-	chatCmdTokenFlag      = "token"
-	chatCmdPrivateKeyFlag = "private-key"
-	chatCmdPublicKeyFlag  = "public-key"
+	chatCmdUsernameFlag    = "username"
+	chatCmdLogLevelFlag    = "log-level"
+	chatCmdPublicKeyFlag   = "public-key"
+	chatCmdMarkdownFlag    = "markdown"
+	chatCmdCheckMDFlag     = "check-markdown"
+	chatCmdOutputFlag      = "output"
+	chatCmdColorFlag       = "color"
+	chatCmdThemeFlag       = "theme"
+	chatCmdTUIFlag         = "tui"
+	chatCmdProfileFlag     = "profile"
+	chatCmdMessageFlag     = "message"
+	chatCmdMessageFileFlag = "message-file"
+	chatCmdOnceFlag        = "once"
 )
 
 var chatCmd = &cobra.Command{
-	Use:              "chat",
-	Short:            "Interact with your agent.",
-	Long:             `This cli tool allows you to debug your agent by chatting with it locally.`,
-	Run:              agentChat,
-	TraverseChildren: true,
-	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		var err error
-		cmd.Flags().VisitAll(func(f *pflag.Flag) {
-			optName := strings.ToUpper(f.Name)
-			optName = strings.ReplaceAll(optName, "-", "_")
-			if val, ok := os.LookupEnv(optName); !f.Changed && ok {
-				fmt.Printf("Setting %s to %s\n", f.Name, val)
-				err2 := f.Value.Set(val)
-				if err2 != nil {
-					err = fmt.Errorf("invalid environment variable %s: %w", optName, err2)
-				}
-			}
-		})
-		return err
-	}}
+	Use:               "chat",
+	Short:             "Interact with your agent.",
+	Long:              `This cli tool allows you to debug your agent by chatting with it locally.`,
+	Run:               agentChat,
+	TraverseChildren:  true,
+	PersistentPreRunE: setFlagsFromEnv,
+}
 
 func init() {
 	chatCmd.CompletionOptions.DisableDefaultCmd = true
 
-	chatCmd.PersistentFlags().String(chatCmdURLFlag, "http://localhost:8080", "url to chat with your agent")
+	addAgentFlags(chatCmd.PersistentFlags())
 	chatCmd.PersistentFlags().String(chatCmdUsernameFlag, "sparklyunicorn", "username to display in chat")
-	chatCmd.PersistentFlags().String(chatCmdTokenFlag, "", "GitHub token for chat authentication (optional)")
 	chatCmd.PersistentFlags().String(chatCmdLogLevelFlag, "DEBUG", "Log level to help debug events. Supported types are `DEBUG`, `TRACE`, `NONE`. `DEBUG` returns general logs. `TRACE` prints the raw http response.")
-	chatCmd.PersistentFlags().String(chatCmdPrivateKeyFlag, "", "Private key for payload verification")
 	chatCmd.PersistentFlags().String(chatCmdPublicKeyFlag, "", "Public key for payload verification")
+	chatCmd.PersistentFlags().Bool(chatCmdMarkdownFlag, false, "Render assistant messages as markdown, the way Copilot Chat does")
+	chatCmd.PersistentFlags().Bool(chatCmdCheckMDFlag, false, "Flag the markdown in assistant messages that Copilot Chat does not render")
+	chatCmd.PersistentFlags().String(chatCmdOutputFlag, chat.OutputPretty, "How to display the chat. Supported formats are pretty, plain, json, markdown. pretty adds colors and tables of the parsed data, plain is text without colors, json writes a line per turn, and markdown writes a transcript.")
+	chatCmd.PersistentFlags().Bool(chatCmdTUIFlag, false, "Chat full screen, with the conversation on the left and a timeline of every SSE event of the selected turn on the right")
+	chatCmd.PersistentFlags().String(chatCmdMessageFlag, "", "Send this message, print the response and exit with the same codes as --once, e.g. from a shell script")
+	chatCmd.PersistentFlags().String(chatCmdMessageFileFlag, "", "Send the contents of this file, print the response and exit with the same codes as --once")
+	chatCmd.PersistentFlags().Bool(chatCmdOnceFlag, false, "Send the message read from stdin, print the response and exit. The exit code is 0 on success, 1 for invalid flags, 2 when the agent could not be reached or the response was cut short, 3 for a non-2xx status, 4 when the response broke a protocol rule with the error severity, and 5 when the agent sent copilot_errors.")
+	chatCmd.MarkFlagsMutuallyExclusive(chatCmdMessageFlag, chatCmdMessageFileFlag, chatCmdOnceFlag)
+	chatCmd.PersistentFlags().String(chatCmdProfileFlag, "default", "Name of the input history to recall with the up arrow and Ctrl+R, e.g. one per agent. Histories are kept in the gh-debug-cli directory of your config directory.")
+	chatCmd.PersistentFlags().String(chatCmdColorFlag, chat.ColorModeAuto, "When to color the chat. Supported modes are auto, always, never. auto colors the chat when writing to a terminal and NO_COLOR is not set.")
+	chatCmd.PersistentFlags().String(chatCmdThemeFlag, "", "Path to a JSON file remapping the colors of the chat, e.g. {\"user\": \"blue\", \"role\": \"bright-cyan\", \"error\": \"38;5;196\"}. Supported keys are user, role, debug, error, warning, info, trace, heading, code, keyword, string, number, comment.")
 
 }
 
 func agentChat(cmd *cobra.Command, args []string) {
 
-	url, _ := cmd.Flags().GetString(chatCmdURLFlag)
-	if url == "" {
-		fmt.Println("a url is required to chat with your agent")
+	agent, err := parseAgentFlags(cmd.Flags())
+	if err != nil {
+		exitChat(chat.ExitUsage, err)
 	}
 
 	username, _ := cmd.Flags().GetString(chatCmdUsernameFlag)
 
-	token, _ := cmd.Flags().GetString(chatCmdTokenFlag)
-
 	debug, _ := cmd.Flags().GetString(chatCmdLogLevelFlag)
 	debug = strings.ToUpper(debug)
 	if debug != chat.LEVEL_NONE && debug != chat.LEVEL_DEBUG && debug != chat.LEVEL_TRACE {
-		fmt.Println("debug mode must be either `DEBUG`, `TRACE`, or `NONE`")
+		exitChat(chat.ExitUsage, "debug mode must be either `DEBUG`, `TRACE`, or `NONE`")
+	}
+
+	markdown, _ := cmd.Flags().GetBool(chatCmdMarkdownFlag)
+
+	checkMarkdown, _ := cmd.Flags().GetBool(chatCmdCheckMDFlag)
+
+	color, _ := cmd.Flags().GetString(chatCmdColorFlag)
+	colors, err := chat.NewColors(color, os.Stdout)
+	if err != nil {
+		exitChat(chat.ExitUsage, err)
+	}
+	// the logs go to stderr, which may be redirected on its own
+	logColors, _ := chat.NewColors(color, os.Stderr)
+	if path, _ := cmd.Flags().GetString(chatCmdThemeFlag); path != "" {
+		if colors.Theme, err = chat.LoadTheme(path); err != nil {
+			exitChat(chat.ExitUsage, err)
+		}
+		logColors.Theme = colors.Theme
+	}
+
+	output, _ := cmd.Flags().GetString(chatCmdOutputFlag)
+	renderer, err := chat.NewRenderer(output, chat.RenderOptions{
+		LogLevel:      debug,
+		Markdown:      markdown,
+		CheckMarkdown: checkMarkdown,
+		Colors:        colors,
+	})
+	if err != nil {
+		exitChat(chat.ExitUsage, err)
+	}
+
+	profile, _ := cmd.Flags().GetString(chatCmdProfileFlag)
+	historyFile, err := chat.HistoryPath(profile)
+	if err != nil {
+		exitChat(chat.ExitUsage, err)
+	}
+
+	message, _ := cmd.Flags().GetString(chatCmdMessageFlag)
+	if path, _ := cmd.Flags().GetString(chatCmdMessageFileFlag); path != "" {
+		message, err = chat.ReadMessageFile(path)
+		if err != nil {
+			exitChat(chat.ExitUsage, err)
+		}
+	}
+	if once, _ := cmd.Flags().GetBool(chatCmdOnceFlag); once {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			exitChat(chat.ExitUsage, fmt.Errorf("error reading from stdin: %w", err))
+		}
+		message = strings.TrimRight(string(b), "\r\n")
+		if strings.TrimSpace(message) == "" {
+			exitChat(chat.ExitUsage, "--once sends the message read from stdin, which is empty")
+		}
+	}
+
+	opts := chat.Options{
+		URL:           agent.URL,
+		Username:      username,
+		Token:         agent.Token,
+		LogLevel:      debug,
+		Timeout:       agent.Timeout,
+		IdleTimeout:   agent.IdleTimeout,
+		Signer:        agent.Signer,
+		ParseMode:     agent.ParseMode,
+		Rules:         agent.Rules,
+		Markdown:      markdown,
+		CheckMarkdown: checkMarkdown,
+		Colors:        colors,
+		LogColors:     logColors,
+		Renderer:      renderer,
+		HistoryFile:   historyFile,
+		Message:       message,
+		Redactor:      agent.Redactor,
 	}
 
-	err := chat.Chat(url, username, token, debug)
+	tui, _ := cmd.Flags().GetBool(chatCmdTUIFlag)
+	if tui && message != "" {
+		exitChat(chat.ExitUsage, "--tui cannot be used to send a single message")
+	}
+	if tui {
+		err = chat.RunTUI(opts)
+	} else {
+		err = chat.Chat(opts)
+	}
+
+	// a failed single message turn was already displayed
+	var exitErr *chat.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
 	if err != nil {
-		fmt.Println(err)
+		exitChat(chat.ExitTransportError, err)
 	}
 }
+
+// exitChat prints why the chat failed and exits with the given code.
+func exitChat(code int, err any) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(code)
+}
@@ -0,0 +1,70 @@
+// doctor.go
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/github-technology-partners/gh-debug-cli/pkg/doctor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	doctorCmdTimeoutFlag = "timeout"
+	doctorCmdColorFlag   = "color"
+)
+
+// doctorCmd preflights an agent before chatting with it
+var doctorCmd = &cobra.Command{
+	Use:               "doctor",
+	Short:             "Preflight your agent endpoint.",
+	Long:              `Runs a set of checks against your agent to make sure it is reachable and speaks the agent protocol before you start chatting with it.`,
+	Run:               agentDoctor,
+	PersistentPreRunE: setFlagsFromEnv,
+}
+
+func init() {
+	addConnectionFlags(doctorCmd.PersistentFlags())
+	doctorCmd.PersistentFlags().Duration(doctorCmdTimeoutFlag, 30*time.Second, "timeout for each request sent to the agent. 0 means no limit.")
+	doctorCmd.PersistentFlags().String(doctorCmdColorFlag, chat.ColorModeAuto, "when to color the results: auto, always or never. auto colors them when writing to a terminal and NO_COLOR is not set.")
+}
+
+func agentDoctor(cmd *cobra.Command, args []string) {
+	agent, err := parseConnectionFlags(cmd.Flags())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	timeout, _ := cmd.Flags().GetDuration(doctorCmdTimeoutFlag)
+	color, _ := cmd.Flags().GetString(doctorCmdColorFlag)
+	colors, err := chat.NewColors(color, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Checking agent at %s...\n\n", agent.Redactor.String(agent.URL))
+
+	results, err := doctor.Run(context.Background(), doctor.Options{
+		URL:      agent.URL,
+		Token:    agent.Token,
+		Timeout:  timeout,
+		Signer:   agent.Signer,
+		Redactor: agent.Redactor,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, r := range results {
+		fmt.Print(r.Format(colors))
+	}
+
+	if doctor.Failed(results) {
+		os.Exit(1)
+	}
+}
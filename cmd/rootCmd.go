@@ -4,8 +4,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var rootCmd = &cobra.Command{
@@ -26,4 +29,72 @@ func init() {
 	// Add subcommands to rootCmd
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(streamCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(uiCmd)
+}
+
+// envPrefix prefixes the environment variables setting the flags.
+const envPrefix = "GH_DEBUG_"
+
+// legacyEnvFlags are the flags that are also read from an environment variable
+// without the envPrefix, as they were before it was introduced.
+var legacyEnvFlags = map[string]bool{
+	"url":         true,
+	"username":    true,
+	"token":       true,
+	"log-level":   true,
+	"private-key": true,
+	"public-key":  true,
+}
+
+// setFlagsFromEnv sets any flag that was not passed on the command line from
+// an environment variable of the same name in all caps with the envPrefix,
+// e.g. --log-level from GH_DEBUG_LOG_LEVEL. The legacyEnvFlags are read from
+// the name without the prefix too, e.g. LOG_LEVEL.
+func setFlagsFromEnv(cmd *cobra.Command, args []string) error {
+	type envFlag struct {
+		name, env, val string
+	}
+
+	var envFlags []envFlag
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		optName := strings.ReplaceAll(strings.ToUpper(f.Name), "-", "_")
+		if val, ok := os.LookupEnv(envPrefix + optName); ok {
+			envFlags = append(envFlags, envFlag{f.Name, envPrefix + optName, val})
+		} else if val, ok := os.LookupEnv(optName); ok && legacyEnvFlags[f.Name] {
+			envFlags = append(envFlags, envFlag{f.Name, optName, val})
+		}
+	})
+
+	// set the flags through the flag set so they count as changed, like the
+	// ones passed on the command line
+	for _, f := range envFlags {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Setting %s to %s\n", f.name, redactFlagValue(f.name, f.val))
+		if err := cmd.Flags().Set(f.name, f.val); err != nil {
+			return fmt.Errorf("invalid environment variable %s: %w", f.env, err)
+		}
+	}
+	return nil
+}
+
+// secretFlags are the flags whose values are never printed.
+var secretFlags = map[string]bool{
+	"token":       true,
+	"private-key": true,
+}
+
+// redactFlagValue masks the value of a flag before it is printed.
+func redactFlagValue(name, val string) string {
+	if secretFlags[name] {
+		return chat.Redacted
+	}
+	redactor, err := chat.NewRedactor()
+	if err != nil {
+		return chat.Redacted
+	}
+	return redactor.String(val)
 }
@@ -0,0 +1,70 @@
+// ui.go
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/github-technology-partners/gh-debug-cli/pkg/ui"
+	"github.com/spf13/cobra"
+)
+
+const (
+	uiCmdAddrFlag = "addr"
+)
+
+// uiCmd serves a web page to chat with an agent from a browser
+var uiCmd = &cobra.Command{
+	Use:               "ui",
+	Short:             "Chat with your agent from a browser.",
+	Long:              `Serves a local web page to chat with your agent, with live-streamed responses, expandable reference, error and confirmation cards, the raw SSE events of every turn and a timing chart.`,
+	Run:               agentUI,
+	PersistentPreRunE: setFlagsFromEnv,
+}
+
+func init() {
+	addAgentFlags(uiCmd.PersistentFlags())
+	uiCmd.PersistentFlags().String(uiCmdAddrFlag, "127.0.0.1:8090", "address to serve the web page on. Anyone who can reach it can chat with your agent using your token.")
+}
+
+func agentUI(cmd *cobra.Command, args []string) {
+	agent, err := parseAgentFlags(cmd.Flags())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	addr, _ := cmd.Flags().GetString(uiCmdAddrFlag)
+
+	clientOpts := []chat.ClientOption{
+		chat.WithURL(agent.URL),
+		chat.WithToken(agent.Token),
+		chat.WithIdleTimeout(agent.IdleTimeout),
+		chat.WithParseMode(agent.ParseMode),
+		chat.WithRules(agent.Rules),
+		chat.WithRedactor(agent.Redactor),
+	}
+	if agent.Signer != nil {
+		clientOpts = append(clientOpts, chat.WithSigner(agent.Signer))
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	server, err := ui.NewServer(ui.Options{ClientOptions: clientOpts, Timeout: agent.Timeout, Addr: listener.Addr().String(), Redactor: agent.Redactor})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Chat with the agent at %s on http://%s\n", agent.Redactor.String(agent.URL), listener.Addr())
+
+	if err := http.Serve(listener, server); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,241 @@
+// Package agenttest runs conversations against an agent http.Handler in
+// process, so agent protocol compliance can be checked with go test.
+package agenttest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+)
+
+// Agent is an agent handler served by an httptest server, along with the
+// history of the conversation held with it.
+type Agent struct {
+	t       testing.TB
+	server  *httptest.Server
+	client  *chat.Client
+	capture *captureTransport
+	signer  *chat.KeySigner
+
+	conversation chat.Conversation
+}
+
+// Turn is the outcome of a single turn of a conversation.
+type Turn struct {
+	// Response is the response assembled from the agent's events. It is nil
+	// when Err is set.
+	Response *chat.Response
+
+	// Events are the events of the response, in the order they were parsed.
+	Events []chat.Event
+
+	// Raw is the raw response body.
+	Raw []byte
+
+	// Violations are the agent protocol rules broken by the response.
+	Violations []chat.Violation
+
+	// Err is set when the turn could not be completed, e.g. when the agent
+	// responded with a non-2xx status.
+	Err error
+}
+
+// New serves handler with an httptest server that is closed when the test
+// ends. The requests are signed with a key generated for the test, whose
+// public key the handler can verify them with. The options configure the
+// client talking to the agent, e.g. chat.WithToken, WithoutSigning or
+// chat.WithSigner to sign the requests with another key, or
+// chat.WithParseMode and chat.WithRules to configure the rules checked on
+// every response.
+func New(t testing.TB, handler http.Handler, opts ...chat.ClientOption) *Agent {
+	t.Helper()
+
+	signer, err := chat.GenerateKeySigner()
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	capture := &captureTransport{base: server.Client().Transport}
+	opts = append([]chat.ClientOption{chat.WithSigner(signer)}, opts...)
+	opts = append(opts,
+		chat.WithURL(server.URL),
+		chat.WithHTTPClient(&http.Client{Transport: capture}),
+	)
+
+	client, err := chat.NewClient(opts...)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	return &Agent{
+		t:       t,
+		server:  server,
+		client:  client,
+		capture: capture,
+		signer:  signer,
+	}
+}
+
+// WithoutSigning sends the requests without a payload signature, e.g. to
+// check that the handler rejects them.
+func WithoutSigning() chat.ClientOption {
+	return chat.WithSigner(nil)
+}
+
+// URL returns the url the agent is served at.
+func (a *Agent) URL() string {
+	return a.server.URL
+}
+
+// PublicKey returns the PEM encoded public key of the key generated to sign
+// the requests, for the handler to verify their signatures with.
+func (a *Agent) PublicKey() string {
+	return a.signer.PublicKey()
+}
+
+// KeyID returns the identifier of the key generated to sign the requests, as
+// sent in the Github-Public-Key-Identifier header.
+func (a *Agent) KeyID() string {
+	return a.signer.Identifier()
+}
+
+// History returns the conversation history so far, with the first choice of
+// every response.
+func (a *Agent) History() []chat.Message {
+	return a.conversation.Messages()
+}
+
+// Send sends a user message, along with the history of the conversation, and
+// returns the agent's response. The assistant messages of the first choice are
+// appended to the history when the turn succeeds, as Copilot does.
+func (a *Agent) Send(content string) *Turn {
+	return a.SendContext(context.Background(), content)
+}
+
+// SendContext is like Send with a context.
+func (a *Agent) SendContext(ctx context.Context, content string) *Turn {
+	a.t.Helper()
+
+	a.conversation.AddUser(content)
+
+	a.capture.Reset()
+	turn := &Turn{}
+
+	stream := a.client.Stream(ctx, a.conversation.Messages())
+	for event := range stream.Events() {
+		turn.Events = append(turn.Events, event)
+	}
+	turn.Response, turn.Err = stream.Wait()
+	turn.Raw = a.capture.Bytes()
+
+	if turn.Err != nil {
+		a.conversation.DropLast()
+		return turn
+	}
+
+	turn.Violations = turn.Response.Violations
+	a.conversation.AddResponse(turn.Response)
+
+	return turn
+}
+
+// Converse sends each prompt in order, as a single conversation.
+func (a *Agent) Converse(prompts ...string) []*Turn {
+	a.t.Helper()
+
+	var turns []*Turn
+	for _, prompt := range prompts {
+		turns = append(turns, a.Send(prompt))
+	}
+	return turns
+}
+
+// Content returns the content of the assistant messages of the first choice
+// of the turn, the one Copilot displays.
+func (t *Turn) Content() string {
+	if t.Response == nil {
+		return ""
+	}
+
+	var content strings.Builder
+	for _, msg := range t.Response.FirstChoice() {
+		content.WriteString(msg.Content)
+	}
+	return content.String()
+}
+
+// References returns the references sent during the turn.
+func (t *Turn) References() []chat.Reference {
+	var refs []chat.Reference
+	for _, e := range t.Events {
+		refs = append(refs, e.References...)
+	}
+	return refs
+}
+
+// Errors returns the copilot_errors sent during the turn.
+func (t *Turn) Errors() []chat.CopilotError {
+	var errs []chat.CopilotError
+	for _, e := range t.Events {
+		errs = append(errs, e.Errors...)
+	}
+	return errs
+}
+
+// Confirmation returns the confirmation sent during the turn, if any.
+func (t *Turn) Confirmation() *chat.Confirmation {
+	for _, e := range t.Events {
+		if e.Confirmation != nil {
+			return e.Confirmation
+		}
+	}
+	return nil
+}
+
+// captureTransport keeps a copy of the last response body it read.
+type captureTransport struct {
+	base http.RoundTripper
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (c *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(resp.Body, c), resp.Body}
+	return resp, nil
+}
+
+func (c *captureTransport) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *captureTransport) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf.Reset()
+}
+
+func (c *captureTransport) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buf.Bytes()...)
+}
@@ -0,0 +1,133 @@
+package agenttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/github-technology-partners/gh-debug-cli/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blackbeard answers every message, and sends a reference when asked to.
+func blackbeard(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	sse := protocol.NewWriter(w)
+	if strings.Contains(string(body), "bad reference") {
+		sse.WriteReferences(chat.Reference{Type: "ref", ID: "1"})
+	} else if strings.Contains(string(body), "reference") {
+		sse.WriteReferences(chat.Reference{Type: "ref", ID: "1", Metadata: chat.ReferenceMetadata{DisplayName: "Treasure map"}})
+	}
+	sse.WriteText("Ahoy, matey!")
+	sse.WriteDone()
+}
+
+func TestAgent_Send(t *testing.T) {
+	agent := New(t, http.HandlerFunc(blackbeard), chat.WithToken("token"))
+
+	turn := agent.Send("hello")
+	AssertValid(t, turn)
+	AssertContent(t, turn, "Ahoy")
+	AssertNoCopilotErrors(t, turn)
+
+	turn = agent.Send("show me a reference")
+	AssertValid(t, turn)
+	AssertReference(t, turn, "1")
+
+	assert.Len(t, agent.History(), 4)
+	assert.Equal(t, "assistant", agent.History()[3].Role)
+}
+
+func TestAgent_Send_Violations(t *testing.T) {
+	agent := New(t, http.HandlerFunc(blackbeard))
+
+	turn := agent.Send("bad reference")
+	assert.NoError(t, turn.Err)
+	AssertViolation(t, turn, chat.RuleReferenceMissingDisplayName)
+	assert.Empty(t, turn.References())
+}
+
+func TestAgent_Send_HTTPError(t *testing.T) {
+	agent := New(t, http.NotFoundHandler())
+
+	turn := agent.Send("hello")
+	assert.ErrorContains(t, turn.Err, "404")
+	assert.Empty(t, agent.History())
+}
+
+func TestAgent_Send_MultipleChoices(t *testing.T) {
+	agent := New(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"ahoy"}},{"index":1,"delta":{"role":"assistant","content":"avast"}}]}
+
+data: [DONE]
+
+`)
+	}))
+
+	turn := agent.Send("hello")
+	assert.NoError(t, turn.Err)
+	assert.Equal(t, "ahoy", turn.Content())
+	assert.Equal(t, []chat.Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "ahoy"},
+	}, agent.History())
+}
+
+func TestAgent_Signature(t *testing.T) {
+	var agent *Agent
+	var signatures []string
+	agent = New(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signatures = append(signatures, r.Header.Get("Github-Public-Key-Signature"))
+
+		block, _ := pem.Decode([]byte(agent.PublicKey()))
+		require.NotNil(t, block)
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		require.NoError(t, err)
+		sig, err := base64.StdEncoding.DecodeString(r.Header.Get("Github-Public-Key-Signature"))
+		require.NoError(t, err)
+		digest := sha256.Sum256(body)
+		assert.True(t, ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], sig))
+		assert.Equal(t, agent.KeyID(), r.Header.Get("Github-Public-Key-Identifier"))
+
+		blackbeard(w, r)
+	}))
+
+	AssertValid(t, agent.Send("hello"))
+	assert.Len(t, signatures, 1)
+}
+
+func TestAgent_WithoutSigning(t *testing.T) {
+	agent := New(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Github-Public-Key-Signature") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		blackbeard(w, r)
+	}), WithoutSigning())
+
+	turn := agent.Send("hello")
+	assert.ErrorContains(t, turn.Err, "401")
+}
+
+func TestAgent_Converse(t *testing.T) {
+	agent := New(t, http.HandlerFunc(blackbeard))
+
+	turns := agent.Converse("hello", "reference please")
+	assert.Len(t, turns, 2)
+	for _, turn := range turns {
+		AssertValid(t, turn)
+	}
+	AssertReference(t, turns[1], "1")
+}
@@ -0,0 +1,111 @@
+package agenttest
+
+import (
+	"fmt"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/stretchr/testify/assert"
+)
+
+// AssertValid asserts that the turn succeeded without breaking any agent
+// protocol rule with an error severity.
+func AssertValid(t assert.TestingT, turn *Turn, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if !assert.NoError(t, turn.Err, msgAndArgs...) {
+		return false
+	}
+
+	var errs []string
+	for _, v := range turn.Violations {
+		if v.Severity == chat.SeverityError {
+			errs = append(errs, v.String())
+		}
+	}
+	return assert.Empty(t, errs, msgAndArgs...)
+}
+
+// AssertViolation asserts that the turn broke the rule with the given id.
+func AssertViolation(t assert.TestingT, turn *Turn, rule string, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	var rules []string
+	for _, v := range turn.Violations {
+		if v.Rule == rule {
+			return true
+		}
+		rules = append(rules, v.Rule)
+	}
+	return assert.Fail(t, fmt.Sprintf("rule %q was not broken, found: %q", rule, rules), msgAndArgs...)
+}
+
+// AssertContent asserts that the assistant content of the turn contains
+// substr.
+func AssertContent(t assert.TestingT, turn *Turn, substr string, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return assert.Contains(t, turn.Content(), substr, msgAndArgs...)
+}
+
+// AssertReference asserts that the turn sent a reference with the given id.
+func AssertReference(t assert.TestingT, turn *Turn, id string, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	var ids []string
+	for _, ref := range turn.References() {
+		if ref.ID == id {
+			return true
+		}
+		ids = append(ids, ref.ID)
+	}
+	return assert.Fail(t, fmt.Sprintf("no reference with id %q, found: %q", id, ids), msgAndArgs...)
+}
+
+// AssertConfirmation asserts that the turn sent a confirmation with the given
+// title.
+func AssertConfirmation(t assert.TestingT, turn *Turn, title string, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	confirmation := turn.Confirmation()
+	if !assert.NotNil(t, confirmation, msgAndArgs...) {
+		return false
+	}
+	return assert.Equal(t, title, confirmation.Title, msgAndArgs...)
+}
+
+// AssertCopilotError asserts that the turn sent a copilot_error with the
+// given code.
+func AssertCopilotError(t assert.TestingT, turn *Turn, code string, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	var codes []string
+	for _, e := range turn.Errors() {
+		if e.Code == code {
+			return true
+		}
+		codes = append(codes, e.Code)
+	}
+	return assert.Fail(t, fmt.Sprintf("no copilot_error with code %q, found: %q", code, codes), msgAndArgs...)
+}
+
+// AssertNoCopilotErrors asserts that the turn did not send any
+// copilot_errors.
+func AssertNoCopilotErrors(t assert.TestingT, turn *Turn, msgAndArgs ...any) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return assert.Empty(t, turn.Errors(), msgAndArgs...)
+}
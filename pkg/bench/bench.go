@@ -0,0 +1,389 @@
+// Package bench load tests an agent with concurrent conversations and reports
+// its throughput, error rate and latencies.
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexeyco/simpletable"
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+)
+
+// Options configures a load test against an agent.
+type Options struct {
+	URL   string
+	Token string
+
+	// Conversations are the user prompts sent to the agent. The prompts of a
+	// conversation are sent in order, each one with the history of the
+	// previous turns.
+	Conversations [][]string
+
+	// Concurrency is the number of conversations in flight at the same time.
+	Concurrency int
+
+	// RampUp spreads the start of the concurrent conversations over this
+	// duration.
+	RampUp time.Duration
+
+	// Duration keeps starting new conversations until it has elapsed. When
+	// zero, every worker runs each conversation once.
+	Duration time.Duration
+
+	// ThinkTime is the pause between two turns of the same conversation.
+	ThinkTime time.Duration
+
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+
+	// Signer signs the requests sent to the agent. Requests are unsigned when
+	// nil.
+	Signer chat.Signer
+
+	// Redactor masks the secrets in the errors of the agent. Defaults to a
+	// Redactor masking the chat.DefaultSecretPatterns and the token.
+	Redactor *chat.Redactor
+}
+
+// LatencyStats summarizes a set of latencies.
+type LatencyStats struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Report is the outcome of a load test.
+type Report struct {
+	Turns      int            `json:"turns"`
+	Errors     int            `json:"errors"`
+	Elapsed    time.Duration  `json:"elapsed"`
+	Throughput float64        `json:"throughput"`
+	ErrorRate  float64        `json:"error_rate"`
+	FirstToken LatencyStats   `json:"first_token"`
+	Completion LatencyStats   `json:"completion"`
+	ErrorKinds map[string]int `json:"error_kinds"`
+}
+
+// scenario is the format of a scenario file.
+type scenario struct {
+	Conversations [][]string `json:"conversations"`
+}
+
+// LoadPrompts reads a prompt list, one prompt per line. Every prompt is a
+// conversation of its own.
+func LoadPrompts(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer file.Close()
+
+	var conversations [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		conversations = append(conversations, []string{line})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	if err := validateConversations(conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// LoadScenario reads a JSON scenario file of the form
+// {"conversations": [["first prompt", "follow-up"], ["another prompt"]]}.
+func LoadScenario(path string) ([][]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+
+	var sc scenario
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return nil, fmt.Errorf("error parsing scenario: %w", err)
+	}
+
+	if err := validateConversations(sc.Conversations); err != nil {
+		return nil, err
+	}
+	return sc.Conversations, nil
+}
+
+// validateConversations checks that there is at least one conversation and
+// that no conversation or prompt is empty, as the workers would otherwise
+// loop without sending anything.
+func validateConversations(conversations [][]string) error {
+	if len(conversations) == 0 {
+		return fmt.Errorf("at least one prompt is required")
+	}
+	for i, conversation := range conversations {
+		if len(conversation) == 0 {
+			return fmt.Errorf("conversation %d has no prompts", i+1)
+		}
+		for j, prompt := range conversation {
+			if strings.TrimSpace(prompt) == "" {
+				return fmt.Errorf("prompt %d of conversation %d is empty", j+1, i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// failureBackoff is the minimum pause after a failed turn.
+const failureBackoff = 100 * time.Millisecond
+
+// result is the outcome of a single turn.
+type result struct {
+	err        error
+	firstToken time.Duration
+	completion time.Duration
+}
+
+// Run runs concurrent conversations against an agent and reports its
+// throughput, error rate and latencies.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("agent url is required")
+	}
+	if err := validateConversations(opts.Conversations); err != nil {
+		return nil, err
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var (
+		mu      sync.Mutex
+		results []result
+		wg      sync.WaitGroup
+	)
+	record := func(r result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}
+
+	start := time.Now()
+	for worker := 0; worker < opts.Concurrency; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			delay := opts.RampUp * time.Duration(worker) / time.Duration(opts.Concurrency)
+			if !sleepCtx(ctx, delay) {
+				return
+			}
+
+			for i := 0; opts.Duration > 0 || i < len(opts.Conversations); i++ {
+				conversation := opts.Conversations[(worker+i)%len(opts.Conversations)]
+				if !runConversation(ctx, opts, conversation, record) {
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	return newReport(results, time.Since(start)), nil
+}
+
+// runConversation runs the turns of a conversation in order and reports
+// whether the load test should go on. The prompt of a failed turn is dropped
+// from the history, as when a user sends it again in the chat.
+func runConversation(ctx context.Context, opts Options, prompts []string, record func(result)) bool {
+	client, err := chat.NewClient(
+		chat.WithURL(opts.URL),
+		chat.WithToken(opts.Token),
+		chat.WithIdleTimeout(opts.IdleTimeout),
+		chat.WithSigner(opts.Signer),
+		chat.WithRedactor(opts.Redactor),
+	)
+	if err != nil {
+		record(result{err: err})
+		return false
+	}
+
+	var conversation chat.Conversation
+	for i, prompt := range prompts {
+		if i > 0 && !sleepCtx(ctx, opts.ThinkTime) {
+			return false
+		}
+
+		conversation.AddUser(prompt)
+
+		var turnCtx context.Context
+		var cancel context.CancelFunc
+		if opts.Timeout > 0 {
+			turnCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		} else {
+			turnCtx, cancel = context.WithCancel(ctx)
+		}
+		resp, err := client.Send(turnCtx, conversation.Messages())
+		cancel()
+
+		// turns cut short by the end of the load test are not counted
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if err != nil {
+			record(result{err: err})
+			conversation.DropLast()
+			// agents failing right away would otherwise spin the worker
+			if !sleepCtx(ctx, failureBackoff) {
+				return false
+			}
+			continue
+		}
+
+		record(result{
+			firstToken: resp.Metrics.TimeToFirstToken,
+			completion: resp.Metrics.Duration,
+		})
+		conversation.AddResponse(resp)
+	}
+
+	return true
+}
+
+func newReport(results []result, elapsed time.Duration) *Report {
+	report := &Report{
+		Turns:      len(results),
+		Elapsed:    elapsed,
+		ErrorKinds: map[string]int{},
+	}
+
+	var firstTokens, completions []time.Duration
+	for _, r := range results {
+		if r.err != nil {
+			report.Errors++
+			report.ErrorKinds[errorKind(r.err)]++
+			continue
+		}
+		if r.firstToken > 0 {
+			firstTokens = append(firstTokens, r.firstToken)
+		}
+		completions = append(completions, r.completion)
+	}
+
+	if elapsed > 0 {
+		report.Throughput = float64(report.Turns) / elapsed.Seconds()
+	}
+	if report.Turns > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Turns)
+	}
+	report.FirstToken = newLatencyStats(firstTokens)
+	report.Completion = newLatencyStats(completions)
+
+	return report
+}
+
+func newLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return LatencyStats{
+		P50: chat.Percentile(latencies, 50),
+		P90: chat.Percentile(latencies, 90),
+		P99: chat.Percentile(latencies, 99),
+		Max: latencies[len(latencies)-1],
+	}
+}
+
+func errorKind(err error) string {
+	var httpErr *chat.HTTPError
+	var interruptedErr *chat.InterruptedError
+	switch {
+	case errors.As(err, &httpErr):
+		return fmt.Sprintf("http %d", httpErr.StatusCode)
+	case errors.As(err, &interruptedErr) && errors.Is(err, chat.ErrStalled):
+		return "stalled"
+	case errors.As(err, &interruptedErr):
+		return "timeout"
+	default:
+		return "transport"
+	}
+}
+
+// sleepCtx sleeps for d and reports whether ctx is still alive afterwards.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (r *Report) String() string {
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignLeft, Text: "Metric"},
+			{Align: simpletable.AlignLeft, Text: "Value"},
+		},
+	}
+
+	cells := [][]*simpletable.Cell{
+		{{Text: "turns"}, {Text: fmt.Sprintf("%d", r.Turns)}},
+		{{Text: "elapsed"}, {Text: chat.FormatDuration(r.Elapsed)}},
+		{{Text: "throughput"}, {Text: fmt.Sprintf("%.2f turns/s", r.Throughput)}},
+		{{Text: "error rate"}, {Text: fmt.Sprintf("%.2f%% (%d)", r.ErrorRate*100, r.Errors)}},
+		{{Text: "first token p50 / p90 / p99 / max"}, {Text: r.FirstToken.String()}},
+		{{Text: "completion p50 / p90 / p99 / max"}, {Text: r.Completion.String()}},
+	}
+
+	kinds := make([]string, 0, len(r.ErrorKinds))
+	for kind := range r.ErrorKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		cells = append(cells, []*simpletable.Cell{{Text: fmt.Sprintf("errors: %s", kind)}, {Text: fmt.Sprintf("%d", r.ErrorKinds[kind])}})
+	}
+	table.Body = &simpletable.Body{Cells: cells}
+
+	table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+		{Align: simpletable.AlignRight, Span: 2, Text: "Load test results"},
+	}}
+
+	table.SetStyle(simpletable.StyleUnicode)
+	return fmt.Sprintf("%s\n", table.String())
+}
+
+func (s LatencyStats) String() string {
+	return fmt.Sprintf("%s / %s / %s / %s", chat.FormatDuration(s.P50), chat.FormatDuration(s.P90), chat.FormatDuration(s.P99), chat.FormatDuration(s.Max))
+}
@@ -0,0 +1,152 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every third request fails
+		if requests.Add(1)%3 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"ahoy\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	report, err := Run(context.Background(), Options{
+		URL:           server.URL,
+		Conversations: [][]string{{"hello", "tell me more"}, {"bye"}},
+		Concurrency:   3,
+	})
+	assert.NoError(t, err)
+
+	// 3 workers each run both conversations once, a failed turn does not end
+	// its conversation
+	assert.Equal(t, 9, report.Turns)
+	assert.Equal(t, int(requests.Load()), report.Turns)
+	assert.Equal(t, 3, report.Errors)
+	assert.Equal(t, report.Errors, report.ErrorKinds["http 500"])
+	assert.Greater(t, report.Completion.P50, time.Duration(0))
+	assert.GreaterOrEqual(t, report.Completion.Max, report.Completion.P99)
+}
+
+func TestRun_FailedTurn(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		histories [][]chat.Message
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chat.Request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		mu.Lock()
+		histories = append(histories, req.Messages)
+		mu.Unlock()
+
+		if req.Messages[len(req.Messages)-1].Content == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"ahoy\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	report, err := Run(context.Background(), Options{
+		URL:           server.URL,
+		Conversations: [][]string{{"hello", "fail", "bye"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Turns)
+	assert.Equal(t, 1, report.Errors)
+
+	require.Len(t, histories, 3)
+	assert.Equal(t, []chat.Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "ahoy"},
+		{Role: "user", Content: "bye"},
+	}, histories[2])
+}
+
+func TestRun_Signer(t *testing.T) {
+	signer, err := chat.GenerateKeySigner()
+	require.NoError(t, err)
+
+	var signature atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature.Store(r.Header.Get("Github-Public-Key-Signature"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	report, err := Run(context.Background(), Options{URL: server.URL, Conversations: [][]string{{"hello"}}, Signer: signer})
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Errors)
+	assert.NotEmpty(t, signature.Load())
+}
+
+func TestRun_Redacted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid key acme_0123456789", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	redactor, err := chat.NewRedactor(`acme_[0-9]+`)
+	require.NoError(t, err)
+
+	var results []result
+	runConversation(context.Background(), Options{URL: server.URL, Redactor: redactor}, []string{"hello"}, func(r result) {
+		results = append(results, r)
+	})
+
+	require.Len(t, results, 1)
+	var httpErr *chat.HTTPError
+	require.ErrorAs(t, results[0].err, &httpErr)
+	assert.Equal(t, "invalid key [REDACTED]\n", string(httpErr.Body))
+}
+
+func TestRun_MissingPrompts(t *testing.T) {
+	tests := []struct {
+		name          string
+		conversations [][]string
+		expected      error
+	}{
+		{name: "no_conversations", conversations: nil, expected: fmt.Errorf("at least one prompt is required")},
+		{name: "empty_conversation", conversations: [][]string{{"hello"}, {}}, expected: fmt.Errorf("conversation 2 has no prompts")},
+		{name: "empty_prompt", conversations: [][]string{{"hello", " "}}, expected: fmt.Errorf("prompt 2 of conversation 1 is empty")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Run(context.Background(), Options{URL: "http://localhost:8080", Conversations: tt.conversations})
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
+func TestLoadScenario_EmptyPrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"conversations": [["hello", ""]]}`), 0o600))
+
+	_, err := LoadScenario(path)
+	assert.Equal(t, fmt.Errorf("prompt 2 of conversation 1 is empty"), err)
+}
@@ -5,80 +5,223 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"net/http/httputil"
-
-	"github.com/google/uuid"
+	"time"
 )
 
-func invokeAgent(ctx context.Context, url string, token string, history []Message, debugMode string) ([]*Message, error) {
-	copilotThreadID := uuid.New().String()
+// Response is the agent's response to a single turn.
+type Response struct {
+	Messages []*Message `json:"messages"`
+	Metrics  Metrics    `json:"metrics"`
+
+	// Violations are the agent protocol rules broken by the response.
+	Violations []Violation `json:"violations,omitempty"`
+
+	// Timeline holds every SSE event of the response, in the order they were
+	// received.
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+}
+
+// TimelineEvent is an SSE event of a response, as it was received and as it
+// was parsed.
+type TimelineEvent struct {
+	// Index is the 1-based index of the event, as used by Violation.Event.
+	Index    int       `json:"index"`
+	Received time.Time `json:"received"`
+	Raw      string    `json:"raw"`
+
+	// Parsed holds the events parsed from the data of the SSE event, and is
+	// empty when the data was invalid or had nothing to emit.
+	Parsed []Event `json:"parsed,omitempty"`
+}
+
+// EventViolations returns the violations reported on the event with the given
+// index, or on the stream as a whole for index 0.
+func (r *Response) EventViolations(index int) []Violation {
+	var violations []Violation
+	for _, v := range r.Violations {
+		if v.Event == index {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+// FirstChoice returns the messages of the first choice of the response, the
+// one Copilot displays and keeps in the history.
+func (r *Response) FirstChoice() []*Message {
+	choices := responseChoices(r)
+	if len(choices) == 0 {
+		return nil
+	}
+
+	var msgs []*Message
+	for _, msg := range r.Messages {
+		if msg.Choice() == choices[0] {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// NewRequest creates the request sending the conversation history to the
+// agent, with the headers Copilot sends and signed when the client has a
+// Signer.
+func (c *Client) NewRequest(ctx context.Context, history []Message) (*http.Request, error) {
 	body := Request{
 		Messages:        history,
-		CopilotThreadID: copilotThreadID,
+		CopilotThreadID: c.threadID,
 	}
 	b, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(b))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	req.Header.Set("Github-Public-Key-Signature", "")
-	req.Header.Set("Github-Public-Key-Identifier", "")
+	if c.signer != nil {
+		if err := c.signer.Sign(req, b); err != nil {
+			return nil, err
+		}
+	} else {
+		req.Header.Set("Github-Public-Key-Signature", "")
+		req.Header.Set("Github-Public-Key-Identifier", "")
+	}
+
+	if c.token != "" {
+		req.Header.Set("X-GitHub-Token", c.token)
+	}
+	return req, nil
+}
+
+func (c *Client) invoke(ctx context.Context, history []Message, emit func(Event)) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if token != "" {
-		req.Header.Set("X-GitHub-Token", token)
+	watchdog := newWatchdog(c.idleTimeout, cancel)
+	defer watchdog.Stop()
+
+	req, err := c.NewRequest(ctx, history)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	metrics := newMetricsRecorder()
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, watchdog.Interrupted(ctx.Err(), nil)
+		}
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
+	metrics.GotHeaders()
+
+	// read the body through the watchdog so a stalled stream cancels the request
+	watchdog.Watch(resp.Body)
+	resp.Body = io.NopCloser(watchdog)
 
 	var buf messageBuffer
+	var timeline []TimelineEvent
 	fn := func(data any) {
+		var event Event
 		switch v := data.(type) {
 		case Completion:
+			for _, choice := range v.Choices {
+				if choice.Delta.Content != "" || choice.Delta.FunctionCall != nil {
+					metrics.GotToken()
+				}
+			}
 			buf.WriteChatMessage(v)
+			event = Event{Type: EventCompletion, Completion: &v}
 
 		case Confirmation:
 			buf.WriteConfirmation(v)
+			event = Event{Type: EventConfirmation, Confirmation: &v}
 
 		case []Reference:
 			buf.WriteReferences(v)
+			event = Event{Type: EventReferences, References: v}
 
 		case []CopilotError:
 			buf.WriteErrors(v)
+			event = Event{Type: EventErrors, Errors: v}
 
 		default:
-			fmt.Printf("Invalid data type: %T\n", v)
+			fmt.Fprintf(c.logOutput, "Invalid data type: %T\n", v)
+			return
+		}
+
+		if len(timeline) > 0 {
+			last := &timeline[len(timeline)-1]
+			last.Parsed = append(last.Parsed, event)
+		}
+		if emit != nil {
+			emit(event)
 		}
 	}
 
-	if shouldLog(debugMode, LEVEL_TRACE) {
-		respDump, err := httputil.DumpResponse(resp, true)
+	// the body is logged event by event as it streams in, dumping it up front
+	// would hand the watchdog and the metrics a buffer instead of the stream
+	trace := shouldLog(c.logLevel, LEVEL_TRACE)
+	if trace {
+		respDump, err := httputil.DumpResponse(resp, false)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("error dumping response: %w", err)
 		}
 
-		fmt.Print(yellow("Raw Response\n" + string(respDump) + "\n\n"))
+		fmt.Fprint(c.logOutput, c.colors.traceColor("Raw Response\n"+c.redactor.String(string(respDump))))
 	}
 
-	parser := NewParser(resp.Body, fn)
-	if err := parser.ParseAndEmit(ctx, debugMode); err != nil {
-		fmt.Println(err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, watchdog.Interrupted(ctx.Err(), nil)
+			}
+			return nil, fmt.Errorf("error reading response: %w", err)
+		}
+		if trace {
+			fmt.Fprint(c.logOutput, c.colors.traceColor(c.redactor.String(string(respBody))+"\n\n"))
+		}
+		httpErr := newHTTPError(resp, respBody)
+		httpErr.Header = c.redactor.Header(httpErr.Header)
+		httpErr.Body = c.redactor.Bytes(httpErr.Body)
+		return nil, httpErr
 	}
 
-	if parser.ValidEventCount() {
-		return nil, fmt.Errorf("cannot have more than one event type in an invocation, found %d", parser.eventCount)
+	parser := NewParser(resp.Body, fn)
+	parser.SetMode(c.parseMode)
+	parser.SetRules(c.rules)
+	parser.OnEvent(func(raw []byte) {
+		metrics.GotEvent()
+		timeline = append(timeline, TimelineEvent{Index: len(timeline) + 1, Received: time.Now(), Raw: string(raw)})
+		if trace {
+			fmt.Fprint(c.logOutput, c.colors.traceColor(c.redactor.String(string(raw))+"\n"))
+		}
+	})
+	// rule violations are reported on the response, so only the stream errors
+	// need to be logged
+	if err := parser.ParseAndEmit(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, watchdog.Interrupted(ctx.Err(), buf)
+		}
+		fmt.Fprintln(c.logOutput, err)
 	}
 
-	return buf, nil
+	return &Response{
+		Messages:   buf,
+		Metrics:    metrics.Metrics(watchdog.Bytes()),
+		Violations: parser.Violations(),
+		Timeline:   timeline,
+	}, nil
 }
@@ -1,249 +1,325 @@
 package chat
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/alexeyco/simpletable"
+	"time"
 )
 
-func Chat(url string, username string, token string, logLevel string) error {
-	if url == "" {
+// Options configures a chat session.
+type Options struct {
+	URL      string
+	Username string
+	Token    string
+	LogLevel string
+
+	// Signer signs the requests sent to the agent. Requests are unsigned when
+	// nil.
+	Signer Signer
+
+	// In, Out and Err default to os.Stdin, os.Stdout and os.Stderr. The logs
+	// of the client are written to Err, so they do not mix with the output.
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+
+	// Timeout bounds how long a single turn may take. Zero means no limit.
+	Timeout time.Duration
+
+	// IdleTimeout cancels a turn when the agent sends no data for this long.
+	// Zero means no limit.
+	IdleTimeout time.Duration
+
+	// ParseMode defaults to ParseModeLenient.
+	ParseMode ParseMode
+
+	// Rules defaults to the severity every rule is registered with.
+	Rules *RuleSet
+
+	// Markdown renders assistant messages as markdown, and CheckMarkdown flags
+	// the markdown Copilot Chat does not render.
+	Markdown      bool
+	CheckMarkdown bool
+
+	// Message is sent as the only turn of a non-interactive session, which
+	// exits once the response is displayed. Chat then returns an ExitError
+	// when the turn failed.
+	Message string
+
+	// HistoryFile persists the input history of sessions on a terminal. The
+	// history is not saved when empty.
+	HistoryFile string
+
+	// Redactor masks the secrets in everything the session displays, logs
+	// included. Defaults to a Redactor masking the DefaultSecretPatterns and
+	// Token.
+	Redactor *Redactor
+
+	// Colors colors the full-screen mode and the default Renderer, and
+	// LogColors the logs written to Err, which may go to a file while the chat
+	// goes to a terminal. The zero Colors leaves them plain.
+	Colors    Colors
+	LogColors Colors
+
+	// Renderer displays the session. Defaults to a PrettyRenderer configured
+	// by LogLevel, Markdown, CheckMarkdown and Colors.
+	Renderer Renderer
+}
+
+func Chat(opts Options) error {
+	if opts.URL == "" {
 		return fmt.Errorf("agent url is required")
 	}
-
-	ctx := context.Background()
-	var history []Message
-
-	if _, err := fmt.Fprintf(os.Stdout, "\nStart typing to chat with your assistant...\n%s: ", magenta(username)); err != nil {
-		return fmt.Errorf("error writing to stdout: %w", err)
+	if opts.In == nil {
+		opts.In = os.Stdin
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.Err == nil {
+		opts.Err = os.Stderr
+	}
+	redactor, err := sessionRedactor(opts)
+	if err != nil {
+		return err
+	}
+	out := redactor.Writer(opts.Out)
+	renderer := opts.Renderer
+	if renderer == nil {
+		renderer = &PrettyRenderer{LogLevel: opts.LogLevel, Markdown: opts.Markdown, CheckMarkdown: opts.CheckMarkdown, Colors: opts.Colors}
 	}
 
-	// Read full message from stdin
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		userMessage := Message{
-			Role:    "user",
-			Content: scanner.Text(),
-		}
-		history = append(history, userMessage)
-
-		msgs, err := invokeAgent(ctx, url, token, history, logLevel)
-		if err != nil {
-			return fmt.Errorf(red("error creating message: %w"), err)
-		}
-
-		for _, msg := range msgs {
-			fmt.Fprint(os.Stdout, &Output{
-				Message:  msg,
-				LogLevel: logLevel,
-			})
+	client, err := newClient(opts, redactor.Writer(opts.Err), redactor)
+	if err != nil {
+		return err
+	}
 
-			chatMsg := Message{
-				Role:    msg.Role,
-				Content: msg.Content,
-			}
-			if msg.FunctionCall != nil {
-				chatMsg.FunctionCall = &ChatMessageFunctionCall{
-					Name:      msg.FunctionCall.Name,
-					Arguments: msg.FunctionCall.Arguments,
-				}
-			}
+	ctx := context.Background()
+	var conversation Conversation
 
-			history = append(history, chatMsg)
-		}
+	// Ctrl+C cancels the turn in flight, or ends the session when waiting for input
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
 
-		if _, err := fmt.Fprintf(os.Stdout, "%s: ", magenta(username)); err != nil {
+	if opts.Message != "" {
+		// a one-shot session sends the message and exits, without prompts
+		resp, err := invokeTurn(ctx, client, opts.Timeout, []Message{{Role: "user", Content: opts.Message}}, interrupts)
+		if err := renderer.Turn(out, Turn{Username: opts.Username, Prompt: opts.Message, Response: resp, Err: err}); err != nil {
 			return fmt.Errorf("error writing to stdout: %w", err)
 		}
+		return turnExitError(resp, err)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading from stdin: %w", err)
+	if err := renderer.Notice(out, Notice{Level: NoticeBanner, Text: "Start typing to chat with your assistant..."}); err != nil {
+		return fmt.Errorf("error writing to stdout: %w", err)
 	}
 
-	return nil
-}
+	input, err := newLineReader(opts, interrupts, redactor)
+	if err != nil {
+		return err
+	}
 
-func (o *Output) String() string {
+	for {
+		var prompt strings.Builder
+		if err := renderer.Prompt(&prompt, opts.Username); err != nil {
+			return fmt.Errorf("error writing to stdout: %w", err)
+		}
 
-	m := o.Message
+		line, err := readMessage(input, prompt.String())
+		switch {
+		case errors.Is(err, errInterrupted):
+			fmt.Fprintln(out)
+			return nil
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
 
-	var msg strings.Builder
-	if m.FunctionCall != nil {
-		if shouldLog(o.LogLevel, LEVEL_DEBUG) {
-			msg.WriteString(green("\nHuzzah! You successfully received a function call!\n"))
+		if choice, ok := parseChoiceCommand(line); ok {
+			if !conversation.PickChoice(choice) {
+				renderer.Notice(out, Notice{Level: NoticeError, Text: fmt.Sprintf("The last response has no such choice, usage: %s N", choiceCommand)})
+			} else {
+				renderer.Notice(out, Notice{Level: NoticeInfo, Text: fmt.Sprintf("Choice %d is now in the history", choice)})
+			}
+			continue
+		}
 
-			table := simpletable.New()
-			table.Header = &simpletable.Header{
-				Cells: []*simpletable.Cell{
-					{Align: simpletable.AlignCenter, Text: "Key"},
-					{Align: simpletable.AlignCenter, Text: "Value"},
-				},
+		if strings.TrimSpace(line) == editMessageCommand {
+			// the editor would compete with the reader of piped input for stdin
+			if _, ok := input.(*scannerReader); ok {
+				renderer.Notice(out, Notice{Level: NoticeError, Text: fmt.Sprintf("%s needs stdin to be a terminal, try %s PATH instead", editMessageCommand, sendFileCommand)})
+				continue
+			}
+			if line, err = editMessage(opts.In, opts.Out); err != nil {
+				renderer.Notice(out, Notice{Level: NoticeError, Text: err.Error()})
+				continue
+			}
+			if strings.TrimSpace(line) == "" {
+				renderer.Notice(out, Notice{Level: NoticeInfo, Text: "The message is empty, nothing was sent"})
+				continue
 			}
-			cells := [][]*simpletable.Cell{
-				{{Text: "role"}, {Text: m.Role}},
-				{{Text: "name"}, {Text: m.FunctionCall.Name}},
-				{{Text: "arguments"}, {Text: m.FunctionCall.Arguments}},
+		} else if path, ok := parseSendFileCommand(line); ok {
+			if path == "" {
+				renderer.Notice(out, Notice{Level: NoticeError, Text: fmt.Sprintf("No file to send, usage: %s PATH", sendFileCommand)})
+				continue
 			}
-			table.Body = &simpletable.Body{Cells: cells}
+			if line, err = ReadMessageFile(path); err != nil {
+				renderer.Notice(out, Notice{Level: NoticeError, Text: err.Error()})
+				continue
+			}
+		}
 
-			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
-				{Align: simpletable.AlignCenter, Span: 2, Text: "Parsed function data"},
-			}}
+		conversation.AddUser(line)
 
-			table.SetStyle(simpletable.StyleUnicode)
-			msg.WriteString(fmt.Sprintf("%s\n", green(table.String())))
+		resp, err := invokeTurn(ctx, client, opts.Timeout, conversation.Messages(), interrupts)
+		if err != nil {
+			// the agent rejected the turn, it was cut short or it could not be
+			// reached, so drop it from the history and let the user try again
+			conversation.DropLast()
 		}
 
-	} else {
-		if m.Role != "" && m.Content != "" {
-			msg.WriteString(fmt.Sprintf("%s: %s\n", cyan(m.Role), m.Content))
-
-			if shouldLog(o.LogLevel, LEVEL_DEBUG) {
-				msg.WriteString(fmt.Sprintf("\n%s\n", green("Huzzah! You successfully received a message!")))
-
-				table := simpletable.New()
-				table.Header = &simpletable.Header{
-					Cells: []*simpletable.Cell{
-						{Align: simpletable.AlignCenter, Text: "Role"},
-						{Align: simpletable.AlignCenter, Text: "Content"},
-					},
-				}
-				cells := [][]*simpletable.Cell{
-					{{Text: m.Role}, {Text: fmt.Sprintf("[condensed] %.50s", m.Content)}},
-				}
-				table.Body = &simpletable.Body{Cells: cells}
-
-				table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
-					{Align: simpletable.AlignRight, Span: 2, Text: "Parsed message data"},
-				}}
-
-				table.SetStyle(simpletable.StyleUnicode)
-				msg.WriteString(fmt.Sprintf("%s\n", green(table.String())))
-			}
+		if err := renderer.Turn(out, Turn{Username: opts.Username, Prompt: line, Response: resp, Err: err}); err != nil {
+			return fmt.Errorf("error writing to stdout: %w", err)
 		}
-	}
-
-	if m.Confirmation != nil {
-		if shouldLog(o.LogLevel, LEVEL_DEBUG) {
-			msg.WriteString(green("\nHuzzah! You successfully received a confirmation!\n"))
 
-			table := simpletable.New()
-			table.Header = &simpletable.Header{
-				Cells: []*simpletable.Cell{
-					{Align: simpletable.AlignLeft, Text: "Key"},
-					{Align: simpletable.AlignLeft, Text: "Value"},
-				},
-			}
+		conversation.AddResponse(resp)
+	}
+}
 
-			cells := [][]*simpletable.Cell{
-				{{Text: "type"}, {Text: m.Confirmation.Type}},
-				{{Text: "title"}, {Text: m.Confirmation.Title}},
-				{{Text: "message"}, {Text: m.Confirmation.Message}},
-				{{Text: "confirmation"}, {Text: fmt.Sprintf("%s", m.Confirmation.Confirmation)}},
-			}
-			table.Body = &simpletable.Body{Cells: cells}
+// sessionRedactor returns the Redactor of a session.
+func sessionRedactor(opts Options) (*Redactor, error) {
+	if opts.Redactor != nil {
+		return opts.Redactor, nil
+	}
+	redactor, err := NewRedactor()
+	if err != nil {
+		return nil, err
+	}
+	redactor.AddSecret(opts.Token)
+	return redactor, nil
+}
 
-			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
-				{Align: simpletable.AlignRight, Span: 2, Text: "Parsed confirmation data"},
-			}}
+// newClient creates the client of a chat session, logging to logOutput.
+func newClient(opts Options, logOutput io.Writer, redactor *Redactor) (*Client, error) {
+	clientOpts := []ClientOption{
+		WithURL(opts.URL),
+		WithToken(opts.Token),
+		WithLogLevel(opts.LogLevel, logOutput),
+		WithIdleTimeout(opts.IdleTimeout),
+		WithRedactor(redactor),
+		WithColors(opts.LogColors),
+	}
+	if opts.Signer != nil {
+		clientOpts = append(clientOpts, WithSigner(opts.Signer))
+	}
+	if opts.ParseMode != "" {
+		clientOpts = append(clientOpts, WithParseMode(opts.ParseMode))
+	}
+	if opts.Rules != nil {
+		clientOpts = append(clientOpts, WithRules(opts.Rules))
+	}
+	return NewClient(clientOpts...)
+}
 
-			table.SetStyle(simpletable.StyleUnicode)
-			msg.WriteString(fmt.Sprintf("%s\n", green(table.String())))
-		}
-		msg.WriteString(cyan(fmt.Sprintf("\n%s\n  %s\nReply: [y/N]\n", m.Confirmation.Title, m.Confirmation.Message)))
-	}
-
-	if len(m.References) > 0 {
-		// When debug mode is turned off, the refrerences are not explicitly displayed
-		if shouldLog(o.LogLevel, LEVEL_DEBUG) {
-			msg.WriteString(green("\nHuzzah! You successfully received some references!\n"))
-
-			table := simpletable.New()
-			table.Header = &simpletable.Header{
-				Cells: []*simpletable.Cell{
-					{Align: simpletable.AlignLeft, Text: "index"},
-					{Align: simpletable.AlignLeft, Text: "id"},
-					{Align: simpletable.AlignLeft, Text: "type"},
-					{Align: simpletable.AlignLeft, Text: "data"},
-					{Align: simpletable.AlignLeft, Text: "display_icon"},
-					{Align: simpletable.AlignLeft, Text: "display_name"},
-					{Align: simpletable.AlignLeft, Text: "display_url"},
-				},
-			}
+const choiceCommand = "/choice"
 
-			var cells [][]*simpletable.Cell
-			for i, reference := range m.References {
-				cells = append(cells, []*simpletable.Cell{
-					{Text: fmt.Sprintf("%d", i)},
-					{Text: reference.ID},
-					{Text: reference.Type},
-					{Text: fmt.Sprintf("[condensed] %.20s", reference.Data)},
-					{Text: reference.Metadata.DisplayIcon},
-					{Text: reference.Metadata.DisplayName},
-					{Text: reference.Metadata.DisplayURL},
-				})
+// parseChoiceCommand parses a `/choice N` command, returning -1 when N is not
+// a number.
+func parseChoiceCommand(line string) (int, bool) {
+	arg, ok := strings.CutPrefix(strings.TrimSpace(line), choiceCommand)
+	if !ok || (arg != "" && arg[0] != ' ') {
+		return 0, false
+	}
 
-			}
-			table.Body = &simpletable.Body{Cells: cells}
+	index, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		return -1, true
+	}
+	return index, true
+}
 
-			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
-				{Align: simpletable.AlignRight, Span: 7, Text: "Parsed references data"},
-			}}
+// responseChoices returns the sorted indexes of the choices of a response.
+func responseChoices(resp *Response) []int {
+	if resp == nil {
+		return nil
+	}
 
-			table.SetStyle(simpletable.StyleUnicode)
-			msg.WriteString(fmt.Sprintf("%s\n", green(table.String())))
+	seen := map[int]bool{}
+	var choices []int
+	for _, msg := range resp.Messages {
+		if !seen[msg.Choice()] {
+			seen[msg.Choice()] = true
+			choices = append(choices, msg.Choice())
 		}
+	}
+	sort.Ints(choices)
+	return choices
+}
 
-		for i, reference := range m.References {
-			msg.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, reference.ID, reference.Metadata.DisplayName))
+// hasChoice reports whether a response has a choice with the given index.
+func hasChoice(resp *Response, choice int) bool {
+	for _, c := range responseChoices(resp) {
+		if c == choice {
+			return true
 		}
 	}
+	return false
+}
 
-	if len(m.Errors) > 0 {
-		table := simpletable.New()
-
-		if shouldLog(o.LogLevel, LEVEL_DEBUG) {
-			msg.WriteString(green("\nHuzzah! You successfully received some errors!\n"))
-
-			table.Header = &simpletable.Header{
-				Cells: []*simpletable.Cell{
-					{Align: simpletable.AlignLeft, Text: "index"},
-					{Align: simpletable.AlignLeft, Text: "message"},
-					{Align: simpletable.AlignLeft, Text: "type"},
-					{Align: simpletable.AlignLeft, Text: "code"},
-					{Align: simpletable.AlignLeft, Text: "identifier"},
-				},
-			}
+// historyMessages returns the messages of a choice as they are sent back to
+// the agent.
+func historyMessages(msgs []*Message, choice int) []Message {
+	var history []Message
+	for _, msg := range msgs {
+		if msg.Choice() != choice {
+			continue
+		}
 
-			var cells [][]*simpletable.Cell
-			for i, error := range m.Errors {
-				cells = append(cells, []*simpletable.Cell{
-					{Text: fmt.Sprintf("%d", i)},
-					{Text: error.Message},
-					{Text: error.Type},
-					{Text: error.Code},
-					{Text: error.Identifier},
-				})
+		chatMsg := Message{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			ToolCalls: msg.ToolCalls,
+		}
+		if msg.FunctionCall != nil {
+			chatMsg.FunctionCall = &ChatMessageFunctionCall{
+				Name:      msg.FunctionCall.Name,
+				Arguments: msg.FunctionCall.Arguments,
 			}
-			table.Body = &simpletable.Body{Cells: cells}
-
-			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
-				{Align: simpletable.AlignRight, Span: 5, Text: "Parsed error data"},
-			}}
-
-			table.SetStyle(simpletable.StyleUnicode)
-			msg.WriteString(fmt.Sprintf("%s\n", green(table.String())))
 		}
+		history = append(history, chatMsg)
+	}
+	return history
+}
 
-		for i, error := range m.Errors {
-			msg.WriteString(fmt.Sprintf("%d. %s error: %s\n", i+1, error.Type, error.Message))
-		}
+// invokeTurn sends a single turn to the agent, cancelling it if the turn times
+// out or an interrupt is received while it is in flight.
+func invokeTurn(ctx context.Context, client *Client, timeout time.Duration, history []Message, interrupts <-chan os.Signal) (*Response, error) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-done:
+		}
+	}()
 
-	return msg.String()
+	return client.Send(ctx, history)
 }
@@ -1,10 +1,19 @@
 package chat
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestChat(t *testing.T) {
@@ -33,37 +42,366 @@ func TestChat(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actualError := Chat(tt.url, tt.username, tt.token, LEVEL_NONE)
+			actualError := Chat(Options{
+				URL:      tt.url,
+				Username: tt.username,
+				Token:    tt.token,
+				LogLevel: LEVEL_NONE,
+			})
 			assert.Equal(t, tt.expectedError, actualError)
 		})
 	}
 }
 
-func TestOutput_String(t *testing.T) {
+func TestChat_Choices(t *testing.T) {
+	var requests []Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"ahoy"}},{"index":1,"delta":{"role":"assistant","content":"avast"}}]}
+
+data: [DONE]
+
+`)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := Chat(Options{
+		URL:      server.URL,
+		Username: "username",
+		LogLevel: LEVEL_NONE,
+		In:       strings.NewReader("hello\n/choice 2\n/choice 1\nthanks\n"),
+		Out:      &out,
+	})
+	assert.NoError(t, err)
+
+	assert.Contains(t, out.String(), "--- Choice 1 ---")
+	assert.Contains(t, out.String(), "Alas...The last response has no such choice")
+	assert.Contains(t, out.String(), "Choice 1 is now in the history")
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "avast"},
+		{Role: "user", Content: "thanks"},
+	}, requests[1].Messages)
+}
+
+// echoAgent answers every turn with the content of the last message.
+func echoAgent(t *testing.T, requests *[]Request) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		*requests = append(*requests, req)
+
+		content, _ := json.Marshal("echo: " + req.Messages[len(req.Messages)-1].Content)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%s},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n", content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestChat_ComposeCommands(t *testing.T) {
+	var requests []Request
+	server := echoAgent(t, &requests)
+
+	dir := t.TempDir()
+	prompt := filepath.Join(dir, "prompt.md")
+	require.NoError(t, os.WriteFile(prompt, []byte("# Task\n\nfix it\n"), 0o600))
+	empty := filepath.Join(dir, "empty.md")
+	require.NoError(t, os.WriteFile(empty, []byte(" \n\n"), 0o600))
+
+	var out bytes.Buffer
+	err := Chat(Options{
+		URL:      server.URL,
+		Username: "username",
+		LogLevel: LEVEL_NONE,
+		In:       strings.NewReader("/send-file " + prompt + "\n/send-file\n/send-file missing.md\n/send-file " + empty + "\n/edit-message\n"),
+		Out:      &out,
+	})
+	assert.NoError(t, err)
+
+	assert.Contains(t, out.String(), "Alas...No file to send, usage: /send-file PATH")
+	assert.Contains(t, out.String(), "Alas...could not read message file")
+	assert.Contains(t, out.String(), "Alas...message file is empty: "+empty)
+	assert.Contains(t, out.String(), "Alas.../edit-message needs stdin to be a terminal, try /send-file PATH instead")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "# Task\n\nfix it", requests[0].Messages[0].Content)
+}
+
+func TestChat_JSONOutput(t *testing.T) {
+	var requests []Request
+	server := echoAgent(t, &requests)
+
+	var out, logs bytes.Buffer
+	err := Chat(Options{
+		URL:      server.URL,
+		Username: "username",
+		LogLevel: LEVEL_TRACE,
+		Renderer: &JSONRenderer{},
+		In:       strings.NewReader("hello\n/choice 2\n/send-file\n"),
+		Out:      &out,
+		Err:      &logs,
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), "not a line of JSON: %s", line)
+	}
+	assert.JSONEq(t, `{"notice":"The last response has no such choice, usage: /choice N","level":"error"}`, lines[1])
+	assert.JSONEq(t, `{"notice":"No file to send, usage: /send-file PATH","level":"error"}`, lines[2])
+	assert.NotEmpty(t, logs.String(), "the client logs go to Err")
+}
+
+func TestEditMessage(t *testing.T) {
+	dir := t.TempDir()
+	editor := filepath.Join(dir, "editor.sh")
+	require.NoError(t, os.WriteFile(editor, []byte("#!/bin/sh\nprintf 'from the\\neditor\\n' > \"$1\"\n"), 0o700))
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+
+	message, err := editMessage(strings.NewReader(""), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "from the\neditor", message)
+}
+
+func TestReadMessageFile(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		expectedMessage string
+		expectedError   string
+	}{
+		{
+			name:            "happy_path",
+			content:         "fix it\r\n\n",
+			expectedMessage: "fix it",
+		},
+		{
+			name:          "failure_empty",
+			content:       "",
+			expectedError: "message file is empty",
+		},
+		{
+			name:          "failure_whitespace_only",
+			content:       " \t\n\n",
+			expectedError: "message file is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "prompt.md")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			message, err := ReadMessageFile(path)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedMessage, message)
+		})
+	}
+}
+
+func TestChat_Message(t *testing.T) {
+	var requests []Request
+	server := echoAgent(t, &requests)
+
+	var out bytes.Buffer
+	err := Chat(Options{
+		URL:      server.URL,
+		Username: "username",
+		LogLevel: LEVEL_NONE,
+		Renderer: &PlainRenderer{},
+		In:       strings.NewReader("not read\n"),
+		Out:      &out,
+		Message:  "hello",
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "assistant: echo: hello\n", out.String())
+}
+
+func TestChat_Message_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		stream   string
+		code     int
+		errorMsg string
+	}{
+		{
+			name:     "http_error",
+			status:   http.StatusUnauthorized,
+			code:     ExitHTTPError,
+			errorMsg: "agent responded with 401 Unauthorized (unauthorized)",
+		},
+		{
+			name:     "protocol_error",
+			stream:   "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\nevent: copilot_errors\ndata: {\"type\":\"agent\"}\n\ndata: [DONE]\n\n",
+			code:     ExitProtocolError,
+			errorMsg: "the response broke 1 protocol rules",
+		},
+		{
+			name:     "agent_error",
+			stream:   "event: copilot_errors\ndata: [{\"type\":\"agent\",\"code\":\"E1\",\"message\":\"oops\",\"identifier\":\"1\"}]\n\ndata: [DONE]\n\n",
+			code:     ExitAgentError,
+			errorMsg: "the agent reported 1 errors",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					http.Error(w, "nope", tt.status)
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.stream)
+			}))
+			defer server.Close()
+
+			var out bytes.Buffer
+			err := Chat(Options{URL: server.URL, LogLevel: LEVEL_NONE, Renderer: &JSONRenderer{}, Out: &out, Message: "hello"})
+
+			var exitErr *ExitError
+			require.ErrorAs(t, err, &exitErr)
+			assert.Equal(t, tt.code, exitErr.Code)
+			assert.EqualError(t, err, tt.errorMsg)
+			assert.Equal(t, 1, strings.Count(out.String(), "\n"), "the turn is displayed")
+		})
+	}
+
+	t.Run("transport_error", func(t *testing.T) {
+		server := httptest.NewServer(nil)
+		server.Close()
+
+		var out bytes.Buffer
+		err := Chat(Options{URL: server.URL, LogLevel: LEVEL_NONE, Renderer: &JSONRenderer{}, Out: &out, Message: "hello"})
+
+		var exitErr *ExitError
+		require.ErrorAs(t, err, &exitErr)
+		assert.Equal(t, ExitTransportError, exitErr.Code)
+		assert.Contains(t, out.String(), `"error":`)
+	})
+}
+
+func TestChat_LogColors(t *testing.T) {
+	var requests []Request
+	server := echoAgent(t, &requests)
+
+	// the chat goes to a terminal while the logs are redirected to a file
+	var out, logs bytes.Buffer
+	err := Chat(Options{URL: server.URL, LogLevel: LEVEL_TRACE, Colors: DefaultColors, Out: &out, Err: &logs, Message: "hello"})
+	require.NoError(t, err)
+
+	assert.Contains(t, out.String(), "\x1b[")
+	assert.Contains(t, logs.String(), "Raw Response")
+	assert.NotContains(t, logs.String(), "\x1b[")
+}
+
+func TestChat_TransportError(t *testing.T) {
+	server := httptest.NewServer(nil)
+	server.Close()
+
+	// an unreachable agent fails the turn, not the session
+	var out bytes.Buffer
+	err := Chat(Options{URL: server.URL, LogLevel: LEVEL_NONE, Renderer: &JSONRenderer{}, In: strings.NewReader("hello\nbye\n"), Out: &out})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Contains(t, line, `"error":"error sending request: `)
+		assert.NotContains(t, line, "\\u001b", "no colors in the error")
+	}
+}
+
+func TestPrettyRenderer_Message(t *testing.T) {
 	tests := []struct {
 		name           string
-		output         *Output
+		renderer       *PrettyRenderer
+		message        *Message
 		expectedString string
 	}{
 		{
-			name: "happy_path_function_call",
-			output: &Output{
-				Message: &Message{
-					FunctionCall: &ChatMessageFunctionCall{
-						Name:      "test",
-						Arguments: "args",
-					},
+			name:     "happy_path_function_call",
+			renderer: &PrettyRenderer{LogLevel: LEVEL_DEBUG, Colors: DefaultColors},
+			message: &Message{
+				FunctionCall: &ChatMessageFunctionCall{
+					Name:      "test",
+					Arguments: "args",
+				},
+			},
+			expectedString: "\x1b[32m\nHuzzah! You successfully received a function call!\n\x1b[0m\x1b[32m╔═════════════╤════════╗\n║     Key     │ Value  ║\n╟━━━━━━━━━━━━━┼━━━━━━━━╢\n║ role        │        ║\n║ name        │ test   ║\n║ arguments   │ args   ║\n╟━━━━━━━━━━━━━┼━━━━━━━━╢\n║ Parsed function data ║\n╚═════════════╧════════╝\x1b[0m\n",
+		},
+		{
+			name:     "happy_path_tool_calls",
+			renderer: &PrettyRenderer{LogLevel: LEVEL_DEBUG},
+			message: &Message{
+				Role:      "assistant",
+				ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: ChatMessageFunctionCall{Name: "test", Arguments: "args"}}},
+			},
+			expectedString: "\nHuzzah! You successfully received a tool call!\n╔═══════════╤═══════════╗\n║    Key    │   Value   ║\n╟━━━━━━━━━━━┼━━━━━━━━━━━╢\n║ role      │ assistant ║\n║ id        │ call_1    ║\n║ type      │ function  ║\n║ name      │ test      ║\n║ arguments │ args      ║\n╟━━━━━━━━━━━┼━━━━━━━━━━━╢\n║ Parsed tool call data ║\n╚═══════════╧═══════════╝\n",
+		},
+		{
+			name:     "happy_path_errors",
+			renderer: &PrettyRenderer{LogLevel: LEVEL_NONE, Colors: DefaultColors},
+			message: &Message{
+				Errors: []CopilotError{
+					{Type: ErrorTypeReference, Code: "not_found", Message: "A reference error occurred", Identifier: "ref123"},
+					{Type: ErrorTypeAgent, Code: "rate_limited", Message: "An agent error occurred", Identifier: "agt123"},
+					{Type: ErrorTypeFunction, Code: "timeout", Message: "A function error occurred", Identifier: "fn123"},
 				},
-				LogLevel: LEVEL_DEBUG,
 			},
-			expectedString: "\x1b[32m\nHuzzah! You successfully received a function call!\n\x1b[37m\x1b[32m╔═════════════╤════════╗\n║     Key     │ Value  ║\n╟━━━━━━━━━━━━━┼━━━━━━━━╢\n║ role        │        ║\n║ name        │ test   ║\n║ arguments   │ args   ║\n╟━━━━━━━━━━━━━┼━━━━━━━━╢\n║ Parsed function data ║\n╚═════════════╧════════╝\x1b[37m\n",
+			expectedString: "1. reference error on ref123: A reference error occurred (not_found)\n" +
+				DefaultColors.red("Alas...The agent failed: An agent error occurred (rate_limited)\n") +
+				"2. function error on fn123: A function error occurred (timeout)\n",
+		},
+		{
+			name:     "truncated_message",
+			renderer: &PrettyRenderer{LogLevel: LEVEL_NONE, Colors: DefaultColors},
+			message: &Message{
+				Role:     "assistant",
+				Content:  "Ahoy",
+				Metadata: &MessageMetadata{FinishReason: "length", Chunks: 1},
+			},
+			expectedString: DefaultColors.cyan("assistant") + ": Ahoy\n" +
+				DefaultColors.yellow("The message was cut short because it reached the maximum length (finish_reason: length)\n"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actualString := tt.output.String()
+			actualString := tt.renderer.message(tt.message)
 			assert.Equal(t, tt.expectedString, actualString)
 		})
 	}
 }
+
+func TestViolationsOutput(t *testing.T) {
+	violations := []Violation{
+		{Rule: RuleReferenceMissingID, Severity: SeverityError, Message: "ref 0 is missing an id", Event: 1},
+		{Rule: RuleSSEMultilineData, Severity: SeverityWarning, Message: "event has 2 data lines", Event: 3, Offset: 120},
+		{Rule: RuleEventMultipleTypes, Severity: SeverityError, Message: "found 2"},
+	}
+
+	expected := DefaultColors.red("\nAlas...The response broke agent protocol rules 3 times (2 error, 1 warning):\n") +
+		DefaultColors.red("[error] reference.missing-id: ref 0 is missing an id (event 1 at byte 0)") + "\n" +
+		DefaultColors.yellow("[warning] sse.multiline-data: event has 2 data lines (event 3 at byte 120)") + "\n" +
+		DefaultColors.red("[error] event.multiple-types: found 2 (stream)") + "\n\n"
+
+	assert.Equal(t, expected, violationsOutput(violations, DefaultColors))
+	assert.Empty(t, violationsOutput(nil, DefaultColors))
+}
@@ -0,0 +1,225 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Client sends conversation turns to an agent and parses its responses.
+type Client struct {
+	url         string
+	token       string
+	signer      Signer
+	httpClient  *http.Client
+	threadID    string
+	headers     http.Header
+	logLevel    string
+	logOutput   io.Writer
+	idleTimeout time.Duration
+	parseMode   ParseMode
+	rules       *RuleSet
+	redactor    *Redactor
+	colors      Colors
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithURL sets the url of the agent.
+func WithURL(url string) ClientOption {
+	return func(c *Client) {
+		c.url = url
+	}
+}
+
+// WithToken sets the GitHub token sent in the X-GitHub-Token header.
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithSigner signs every request sent to the agent. Requests are unsigned by
+// default.
+func WithSigner(signer Signer) ClientOption {
+	return func(c *Client) {
+		c.signer = signer
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach the agent. It defaults to
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithThreadID sets the copilot_thread_id sent with every turn. It defaults
+// to a random id shared by all the turns sent by the client.
+func WithThreadID(threadID string) ClientOption {
+	return func(c *Client) {
+		c.threadID = threadID
+	}
+}
+
+// WithHeader sets an extra header sent with every request.
+func WithHeader(key string, value string) ClientOption {
+	return func(c *Client) {
+		c.headers.Set(key, value)
+	}
+}
+
+// WithLogLevel sets the log level and where the logs are written. Nothing is
+// logged by default.
+func WithLogLevel(logLevel string, w io.Writer) ClientOption {
+	return func(c *Client) {
+		c.logLevel = logLevel
+		c.logOutput = w
+	}
+}
+
+// WithIdleTimeout cancels a turn when the agent sends no data for this long.
+func WithIdleTimeout(idleTimeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.idleTimeout = idleTimeout
+	}
+}
+
+// WithParseMode sets how closely the responses must follow what Copilot
+// clients expect. It defaults to ParseModeLenient.
+func WithParseMode(mode ParseMode) ClientOption {
+	return func(c *Client) {
+		c.parseMode = mode
+	}
+}
+
+// WithRules sets the agent protocol rules checked on every response. It
+// defaults to the severity every rule is registered with.
+func WithRules(rules *RuleSet) ClientOption {
+	return func(c *Client) {
+		c.rules = rules
+	}
+}
+
+// WithRedactor sets how secrets are masked in the logs and in the headers and
+// body of an HTTPError. It defaults to a Redactor masking the
+// DefaultSecretPatterns and the token.
+func WithRedactor(redactor *Redactor) ClientOption {
+	return func(c *Client) {
+		c.redactor = redactor
+	}
+}
+
+// WithColors sets how the logs are colored. They are plain by default.
+func WithColors(colors Colors) ClientOption {
+	return func(c *Client) {
+		c.colors = colors
+	}
+}
+
+// NewClient creates a Client. WithURL is required.
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		httpClient: http.DefaultClient,
+		threadID:   uuid.New().String(),
+		headers:    http.Header{},
+		logLevel:   LEVEL_NONE,
+		logOutput:  io.Discard,
+		parseMode:  ParseModeLenient,
+		rules:      NewRuleSet(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.url == "" {
+		return nil, fmt.Errorf("agent url is required")
+	}
+
+	if c.redactor == nil {
+		redactor, err := NewRedactor()
+		if err != nil {
+			return nil, err
+		}
+		redactor.AddSecret(c.token)
+		c.redactor = redactor
+	}
+
+	return c, nil
+}
+
+// Send sends the conversation history to the agent and waits for the full
+// response.
+func (c *Client) Send(ctx context.Context, history []Message) (*Response, error) {
+	return c.invoke(ctx, history, nil)
+}
+
+// Stream sends the conversation history to the agent and emits its events as
+// they are parsed. The events channel must be drained, or ctx cancelled, for
+// the turn to complete.
+func (c *Client) Stream(ctx context.Context, history []Message) *Stream {
+	s := &Stream{
+		events: make(chan Event),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		defer close(s.events)
+
+		s.resp, s.err = c.invoke(ctx, history, func(e Event) {
+			select {
+			case s.events <- e:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	return s
+}
+
+// EventType is the kind of an event sent by an agent.
+type EventType string
+
+const (
+	EventCompletion   EventType = "completion"
+	EventConfirmation EventType = "copilot_confirmation"
+	EventReferences   EventType = "copilot_references"
+	EventErrors       EventType = "copilot_errors"
+)
+
+// Event is a single parsed event of an agent response. Only the field
+// matching its Type is set.
+type Event struct {
+	Type         EventType      `json:"type"`
+	Completion   *Completion    `json:"completion,omitempty"`
+	Confirmation *Confirmation  `json:"confirmation,omitempty"`
+	References   []Reference    `json:"references,omitempty"`
+	Errors       []CopilotError `json:"errors,omitempty"`
+}
+
+// Stream is a response being streamed by an agent.
+type Stream struct {
+	events chan Event
+	done   chan struct{}
+	resp   *Response
+	err    error
+}
+
+// Events returns the events of the response as they are parsed. The channel
+// is closed when the response ends.
+func (s *Stream) Events() <-chan Event {
+	return s.events
+}
+
+// Wait blocks until the response ends and returns the assembled response.
+func (s *Stream) Wait() (*Response, error) {
+	<-s.done
+	return s.resp, s.err
+}
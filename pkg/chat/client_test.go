@@ -0,0 +1,339 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Send_HTTPError(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		contentType  string
+		body         string
+		expectedKind FailureKind
+		expectedBody string
+	}{
+		{
+			name:         "signature_rejected",
+			statusCode:   http.StatusUnauthorized,
+			contentType:  "application/json",
+			body:         `{"message":"invalid payload signature"}`,
+			expectedKind: FailureSignatureRejected,
+			expectedBody: "{\n  \"message\": \"invalid payload signature\"\n}",
+		},
+		{
+			name:         "token_invalid",
+			statusCode:   http.StatusUnauthorized,
+			contentType:  "text/plain",
+			body:         "bad token",
+			expectedKind: FailureTokenInvalid,
+			expectedBody: "bad token",
+		},
+		{
+			name:         "route_not_found",
+			statusCode:   http.StatusNotFound,
+			contentType:  "text/html",
+			body:         "<html>not found</html>",
+			expectedKind: FailureRouteNotFound,
+			expectedBody: "<html>not found</html>",
+		},
+		{
+			name:         "server_error",
+			statusCode:   http.StatusInternalServerError,
+			expectedKind: FailureServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.statusCode)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			client, err := NewClient(WithURL(server.URL), WithToken("token"))
+			assert.NoError(t, err)
+
+			resp, err := client.Send(context.Background(), nil)
+			assert.Nil(t, resp)
+
+			var httpErr *HTTPError
+			if assert.True(t, errors.As(err, &httpErr)) {
+				assert.Equal(t, tt.statusCode, httpErr.StatusCode)
+				assert.Equal(t, tt.expectedKind, httpErr.Kind)
+				assert.Equal(t, tt.expectedBody, prettyBody(httpErr.Body))
+			}
+		})
+	}
+}
+
+func TestClient_Send_Interrupted(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	t.Run("stalled", func(t *testing.T) {
+		client, err := NewClient(WithURL(server.URL), WithIdleTimeout(50*time.Millisecond))
+		assert.NoError(t, err)
+
+		_, err = client.Send(context.Background(), nil)
+
+		var interruptedErr *InterruptedError
+		if assert.True(t, errors.As(err, &interruptedErr)) {
+			assert.ErrorIs(t, err, ErrStalled)
+			assert.Equal(t, int64(50), interruptedErr.Bytes)
+			assert.Len(t, interruptedErr.Messages, 1)
+			assert.Equal(t, "ahoy", interruptedErr.Messages[0].Content)
+		}
+	})
+
+	t.Run("timed_out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		client, err := NewClient(WithURL(server.URL))
+		assert.NoError(t, err)
+
+		_, err = client.Send(ctx, nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestClient_Send_Trace(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var logs bytes.Buffer
+	client, err := NewClient(WithURL(server.URL), WithIdleTimeout(50*time.Millisecond), WithLogLevel(LEVEL_TRACE, &logs))
+	assert.NoError(t, err)
+
+	// the events are logged as they stream in, so the stall is still caught
+	// and the partial response kept
+	_, err = client.Send(context.Background(), nil)
+
+	var interruptedErr *InterruptedError
+	if assert.True(t, errors.As(err, &interruptedErr)) {
+		assert.ErrorIs(t, err, ErrStalled)
+		assert.Len(t, interruptedErr.Messages, 1)
+	}
+	assert.Contains(t, logs.String(), "Raw Response\nHTTP/1.1 200 OK")
+	assert.Contains(t, logs.String(), "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy\"}}]}\n")
+}
+
+func TestClient_Send_Metrics(t *testing.T) {
+	stream := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"ahoy\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, stream)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithURL(server.URL))
+	assert.NoError(t, err)
+
+	resp, err := client.Send(context.Background(), nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, resp.Metrics.Chunks)
+	assert.Equal(t, int64(len(stream)), resp.Metrics.Bytes)
+	assert.Greater(t, resp.Metrics.TimeToHeaders, time.Duration(0))
+	assert.GreaterOrEqual(t, resp.Metrics.TimeToFirstToken, resp.Metrics.TimeToFirstEvent)
+	assert.GreaterOrEqual(t, resp.Metrics.Duration, resp.Metrics.TimeToFirstToken)
+}
+
+func TestClient_Send_MessageMetadata(t *testing.T) {
+	stream := "data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"created\":1700000000,\"system_fingerprint\":\"fp_1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"ahoy\"}}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"gpt-4o\",\"created\":1700000000,\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"length\"}]}\n\n" +
+		"data: {\"id\":\"chatcmpl-1\",\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":1,\"total_tokens\":13}}\n\n" +
+		"data: [DONE]\n\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, stream)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithURL(server.URL))
+	assert.NoError(t, err)
+
+	resp, err := client.Send(context.Background(), nil)
+	assert.NoError(t, err)
+
+	assert.Len(t, resp.Messages, 1)
+	assert.Equal(t, &MessageMetadata{
+		ID:                "chatcmpl-1",
+		Model:             "gpt-4o",
+		Created:           1700000000,
+		SystemFingerprint: "fp_1",
+		FinishReason:      "length",
+		Chunks:            2,
+		Usage:             &Usage{PromptTokens: 12, CompletionTokens: 1, TotalTokens: 13},
+	}, resp.Messages[0].Metadata)
+}
+
+func TestClient_Send_Timeline(t *testing.T) {
+	stream := "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"ahoy\"},\"finish_reason\":\"stop\"}]}\n\n" +
+		"event: copilot_references\ndata: [{\"type\":\"github.issue\"}]\n\n" +
+		"data: [DONE]\n\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, stream)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithURL(server.URL))
+	assert.NoError(t, err)
+
+	resp, err := client.Send(context.Background(), nil)
+	assert.NoError(t, err)
+
+	assert.Len(t, resp.Timeline, 3)
+	for i, e := range resp.Timeline {
+		assert.Equal(t, i+1, e.Index)
+		assert.False(t, e.Received.IsZero())
+	}
+
+	assert.Equal(t, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"ahoy\"},\"finish_reason\":\"stop\"}]}\n", resp.Timeline[0].Raw)
+	assert.Len(t, resp.Timeline[0].Parsed, 1)
+	assert.Equal(t, EventCompletion, resp.Timeline[0].Parsed[0].Type)
+
+	assert.Equal(t, "event: copilot_references\ndata: [{\"type\":\"github.issue\"}]\n", resp.Timeline[1].Raw)
+	assert.NotEmpty(t, resp.EventViolations(2))
+	assert.Empty(t, resp.EventViolations(1))
+
+	assert.Equal(t, "data: [DONE]\n", resp.Timeline[2].Raw)
+	assert.Empty(t, resp.Timeline[2].Parsed)
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient()
+	assert.Equal(t, fmt.Errorf("agent url is required"), err)
+}
+
+func TestClient_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"role":"assistant","content":"ahoy"}}]}
+
+event: copilot_references
+data: [{"type": "ref", "id": "1", "metadata": {"display_name": "Test Reference"}}]
+
+data: [DONE]
+
+`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(WithURL(server.URL))
+	assert.NoError(t, err)
+
+	stream := client.Stream(context.Background(), []Message{{Role: "user", Content: "hello"}})
+
+	var types []EventType
+	for event := range stream.Events() {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []EventType{EventCompletion, EventReferences}, types)
+
+	resp, err := stream.Wait()
+	assert.NoError(t, err)
+	if assert.Len(t, resp.Messages, 1) {
+		assert.Equal(t, "ahoy", resp.Messages[0].Content)
+		assert.Len(t, resp.Messages[0].References, 1)
+	}
+}
+
+func TestClient_Headers(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	signer, err := NewKeySigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+
+	var requests []*http.Request
+	var threadIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		sig, err := base64.StdEncoding.DecodeString(r.Header.Get("Github-Public-Key-Signature"))
+		assert.NoError(t, err)
+		digest := sha256.Sum256(body)
+		assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig))
+
+		var req Request
+		assert.NoError(t, json.Unmarshal(body, &req))
+		requests = append(requests, r)
+		threadIDs = append(threadIDs, req.CopilotThreadID)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		WithURL(server.URL),
+		WithToken("token"),
+		WithSigner(signer),
+		WithThreadID("thread-1"),
+		WithHeader("X-Custom", "custom"),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Send(context.Background(), []Message{{Role: "user", Content: "hello"}})
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"thread-1", "thread-1"}, threadIDs)
+	for _, r := range requests {
+		assert.Equal(t, "token", r.Header.Get("X-GitHub-Token"))
+		assert.Equal(t, "custom", r.Header.Get("X-Custom"))
+		assert.Equal(t, signer.Identifier(), r.Header.Get("Github-Public-Key-Identifier"))
+	}
+}
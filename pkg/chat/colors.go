@@ -1,32 +1,303 @@
 package chat
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/term"
+)
 
 const (
-	ColorDefault = "\x1b[37m"
+	ColorReset   = "\x1b[0m"
 	ColorRed     = "\x1b[31m"
 	ColorGreen   = "\x1b[32m"
 	ColorYellow  = "\x1b[33m"
 	ColorMagenta = "\x1b[35m"
 	ColorCyan    = "\x1b[36m"
+
+	// Deprecated: ColorDefault turns the text white rather than back to the
+	// color of the terminal, use ColorReset instead.
+	ColorDefault = "\x1b[37m"
+)
+
+// The color modes supported by NewColors.
+const (
+	ColorModeAuto   = "auto"
+	ColorModeAlways = "always"
+	ColorModeNever  = "never"
+)
+
+// Colors colors the output of the chat with a theme. The zero Colors leaves
+// the output plain.
+type Colors struct {
+	// Enabled turns every ANSI escape code on or off.
+	Enabled bool
+	Theme   Theme
+}
+
+// DefaultColors colors the output with the DefaultTheme.
+var DefaultColors = Colors{Enabled: true, Theme: DefaultTheme}
+
+// NewColors returns the Colors of a color mode for output written to w, with
+// the DefaultTheme. In auto mode colors are only used when w is a terminal
+// and NO_COLOR is not set.
+func NewColors(mode string, w io.Writer) (Colors, error) {
+	c := DefaultColors
+	switch strings.ToLower(mode) {
+	case ColorModeAlways:
+		c.Enabled = true
+	case ColorModeNever:
+		c.Enabled = false
+	case ColorModeAuto, "":
+		c.Enabled = os.Getenv("NO_COLOR") == "" && isTerminal(w)
+	default:
+		return Colors{}, fmt.Errorf("color must be either `auto`, `always`, or `never`")
+	}
+	return c, nil
+}
+
+// isTerminal reports whether w is a terminal rather than a pipe or a file.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Colorize wraps s in an ANSI escape code, unless colors are turned off.
+func (c Colors) Colorize(code string, s string) string {
+	if !c.Enabled || code == "" {
+		return s
+	}
+	return fmt.Sprintf("%s%s%s", code, s, ColorReset)
+}
+
+func (c Colors) red(s string) string {
+	return c.Colorize(ColorRed, s)
+}
+
+func (c Colors) green(s string) string {
+	return c.Colorize(ColorGreen, s)
+}
+
+func (c Colors) yellow(s string) string {
+	return c.Colorize(ColorYellow, s)
+}
+
+func (c Colors) magenta(s string) string {
+	return c.Colorize(ColorMagenta, s)
+}
+
+func (c Colors) cyan(s string) string {
+	return c.Colorize(ColorCyan, s)
+}
+
+// Theme maps what the chat displays to the escape codes it is colored with.
+type Theme struct {
+	// User colors the username in prompts, and Role the role of messages.
+	User string
+	Role string
+
+	// Debug colors the tables of parsed data, Error and Warning the problems
+	// found in responses, and Info the notes about the session.
+	Debug   string
+	Error   string
+	Warning string
+	Info    string
+
+	// Trace colors the raw responses logged at the TRACE level.
+	Trace string
+
+	// Heading and Code color the headings and code spans of markdown, and
+	// Keyword, String, Number and Comment the code blocks it highlights.
+	Heading string
+	Code    string
+	Keyword string
+	String  string
+	Number  string
+	Comment string
+}
+
+// DefaultTheme is the theme of DefaultColors.
+var DefaultTheme = Theme{
+	User:    ColorMagenta,
+	Role:    ColorCyan,
+	Debug:   ColorGreen,
+	Error:   ColorRed,
+	Warning: ColorYellow,
+	Info:    ColorCyan,
+	Trace:   ColorYellow,
+	Heading: ColorMagenta,
+	Code:    ColorYellow,
+	Keyword: ColorMagenta,
+	String:  ColorYellow,
+	Number:  ColorCyan,
+	Comment: ColorGreen,
+}
+
+// colorNames are the colors a theme file may refer to by name.
+var colorNames = map[string]int{
+	"black":   30,
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   37,
+	"default": 39,
+}
+
+var sgrParams = regexp.MustCompile(`^\d+(;\d+)*$`)
+
+// parseColor returns the escape code of a color name, e.g. `blue` or
+// `bright-blue`, or of SGR parameters, e.g. `38;5;208`.
+func parseColor(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if code, ok := colorNames[s]; ok {
+		return fmt.Sprintf("\x1b[%dm", code), nil
+	}
+	if name, ok := strings.CutPrefix(s, "bright-"); ok {
+		if code, ok := colorNames[name]; ok && name != "default" {
+			return fmt.Sprintf("\x1b[%dm", code+60), nil
+		}
+	}
+	if sgrParams.MatchString(s) {
+		return fmt.Sprintf("\x1b[%sm", s), nil
+	}
+	return "", fmt.Errorf("unknown color %q", s)
+}
+
+// LoadTheme reads a JSON theme file of the form
+// {"user": "blue", "role": "bright-cyan", "error": "38;5;196"}. Colors left
+// out of the file keep their default.
+func LoadTheme(path string) (Theme, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, fmt.Errorf("could not open file: %w", err)
+	}
+
+	var config map[string]string
+	if err := json.Unmarshal(b, &config); err != nil {
+		return Theme{}, fmt.Errorf("error parsing theme: %w", err)
+	}
+
+	t := DefaultTheme
+	fields := map[string]*string{
+		"user":    &t.User,
+		"role":    &t.Role,
+		"debug":   &t.Debug,
+		"error":   &t.Error,
+		"warning": &t.Warning,
+		"info":    &t.Info,
+		"trace":   &t.Trace,
+		"heading": &t.Heading,
+		"code":    &t.Code,
+		"keyword": &t.Keyword,
+		"string":  &t.String,
+		"number":  &t.Number,
+		"comment": &t.Comment,
+	}
+	for name, color := range config {
+		field, ok := fields[name]
+		if !ok {
+			return Theme{}, fmt.Errorf("unknown theme color %q, supported colors are user, role, debug, error, warning, info, trace, heading, code, keyword, string, number, comment", name)
+		}
+		code, err := parseColor(color)
+		if err != nil {
+			return Theme{}, fmt.Errorf("invalid %s color: %w", name, err)
+		}
+		*field = code
+	}
+	return t, nil
+}
+
+func (c Colors) userColor(s string) string {
+	return c.Colorize(c.Theme.User, s)
+}
+
+func (c Colors) roleColor(s string) string {
+	return c.Colorize(c.Theme.Role, s)
+}
+
+func (c Colors) debugColor(s string) string {
+	return c.Colorize(c.Theme.Debug, s)
+}
+
+func (c Colors) errorColor(s string) string {
+	return c.Colorize(c.Theme.Error, s)
+}
+
+func (c Colors) warningColor(s string) string {
+	return c.Colorize(c.Theme.Warning, s)
+}
+
+func (c Colors) infoColor(s string) string {
+	return c.Colorize(c.Theme.Info, s)
+}
+
+func (c Colors) traceColor(s string) string {
+	return c.Colorize(c.Theme.Trace, s)
+}
+
+func (c Colors) headingColor(s string) string {
+	return c.Colorize(c.Theme.Heading, s)
+}
+
+func (c Colors) codeColor(s string) string {
+	return c.Colorize(c.Theme.Code, s)
+}
+
+func (c Colors) keywordColor(s string) string {
+	return c.Colorize(c.Theme.Keyword, s)
+}
+
+func (c Colors) stringColor(s string) string {
+	return c.Colorize(c.Theme.String, s)
+}
+
+func (c Colors) numberColor(s string) string {
+	return c.Colorize(c.Theme.Number, s)
+}
+
+func (c Colors) commentColor(s string) string {
+	return c.Colorize(c.Theme.Comment, s)
+}
+
+// Text attributes are turned off by their own codes, so they can be nested in
+// colored text.
+const (
+	styleBold         = "\x1b[1m"
+	styleBoldOff      = "\x1b[22m"
+	styleItalic       = "\x1b[3m"
+	styleItalicOff    = "\x1b[23m"
+	styleUnderline    = "\x1b[4m"
+	styleUnderlineOff = "\x1b[24m"
+	styleStrike       = "\x1b[9m"
+	styleStrikeOff    = "\x1b[29m"
 )
 
-func red(s string) string {
-	return fmt.Sprintf("%s%s%s", ColorRed, s, ColorDefault)
+func (c Colors) style(on string, off string, s string) string {
+	if !c.Enabled {
+		return s
+	}
+	return fmt.Sprintf("%s%s%s", on, s, off)
 }
 
-func green(s string) string {
-	return fmt.Sprintf("%s%s%s", ColorGreen, s, ColorDefault)
+func (c Colors) bold(s string) string {
+	return c.style(styleBold, styleBoldOff, s)
 }
 
-func yellow(s string) string {
-	return fmt.Sprintf("%s%s%s", ColorYellow, s, ColorDefault)
+func (c Colors) italic(s string) string {
+	return c.style(styleItalic, styleItalicOff, s)
 }
 
-func magenta(s string) string {
-	return fmt.Sprintf("%s%s%s", ColorMagenta, s, ColorDefault)
+func (c Colors) underline(s string) string {
+	return c.style(styleUnderline, styleUnderlineOff, s)
 }
 
-func cyan(s string) string {
-	return fmt.Sprintf("%s%s%s", ColorCyan, s, ColorDefault)
+func (c Colors) strike(s string) string {
+	return c.style(styleStrike, styleStrikeOff, s)
 }
@@ -0,0 +1,116 @@
+package chat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewColors(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		noColor  string
+		expected bool
+		err      bool
+	}{
+		{name: "always", mode: ColorModeAlways, expected: true},
+		{name: "always_ignores_no_color", mode: ColorModeAlways, noColor: "1", expected: true},
+		{name: "never", mode: ColorModeNever, expected: false},
+		{name: "auto_not_a_terminal", mode: ColorModeAuto, expected: false},
+		{name: "unknown", mode: "sometimes", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			colors, err := NewColors(tt.mode, &bytes.Buffer{})
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, colors.Enabled)
+			assert.Equal(t, DefaultTheme, colors.Theme)
+		})
+	}
+}
+
+func TestColorize(t *testing.T) {
+	assert.Equal(t, "\x1b[31mAlas\x1b[0m", DefaultColors.red("Alas"))
+	assert.Equal(t, "\x1b[1mAhoy\x1b[22m", DefaultColors.bold("Ahoy"))
+	assert.Equal(t, "\x1b[34mocto\x1b[0m", Colors{Enabled: true, Theme: Theme{User: "\x1b[34m"}}.userColor("octo"))
+
+	var plain Colors
+	assert.Equal(t, "Alas", plain.red("Alas"))
+	assert.Equal(t, "Ahoy", plain.bold("Ahoy"))
+}
+
+func TestLoadTheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected Theme
+		err      string
+	}{
+		{
+			name:     "partial_theme",
+			contents: `{"user": "blue", "role": "bright-cyan", "error": "38;5;196"}`,
+			expected: Theme{
+				User:    "\x1b[34m",
+				Role:    "\x1b[96m",
+				Debug:   ColorGreen,
+				Error:   "\x1b[38;5;196m",
+				Warning: ColorYellow,
+				Info:    ColorCyan,
+				Trace:   ColorYellow,
+				Heading: ColorMagenta,
+				Code:    ColorYellow,
+				Keyword: ColorMagenta,
+				String:  ColorYellow,
+				Number:  ColorCyan,
+				Comment: ColorGreen,
+			},
+		},
+		{
+			name:     "markdown_colors",
+			contents: `{"heading": "blue", "keyword": "red"}`,
+			expected: func() Theme {
+				t := DefaultTheme
+				t.Heading = "\x1b[34m"
+				t.Keyword = ColorRed
+				return t
+			}(),
+		},
+		{
+			name:     "unknown_color",
+			contents: `{"debug": "chartreuse"}`,
+			err:      `invalid debug color: unknown color "chartreuse"`,
+		},
+		{
+			name:     "unknown_field",
+			contents: `{"prompt": "blue"}`,
+			err:      `unknown theme color "prompt"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "theme.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.contents), 0o600))
+
+			theme, err := LoadTheme(path)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, theme)
+		})
+	}
+}
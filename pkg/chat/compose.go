@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// editMessageCommand opens the user's editor to compose the next message.
+	editMessageCommand = "/edit-message"
+
+	// sendFileCommand sends the contents of a file as the next message.
+	sendFileCommand = "/send-file"
+)
+
+// defaultEditor is used when neither VISUAL nor EDITOR is set.
+const defaultEditor = "vi"
+
+// parseSendFileCommand parses a `/send-file PATH` command, returning an empty
+// path when none is given.
+func parseSendFileCommand(line string) (string, bool) {
+	arg, ok := strings.CutPrefix(strings.TrimSpace(line), sendFileCommand)
+	if !ok || (arg != "" && arg[0] != ' ') {
+		return "", false
+	}
+	return strings.TrimSpace(arg), true
+}
+
+// ReadMessageFile reads a message to send from a file, dropping the trailing
+// newlines editors add. It fails when the file is empty or only holds
+// whitespace, since there would be nothing to send.
+func ReadMessageFile(path string) (string, error) {
+	message, err := readMessageFile(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("message file is empty: %s", path)
+	}
+	return message, nil
+}
+
+// readMessageFile reads a message from a file, dropping the trailing newlines
+// editors add.
+func readMessageFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read message file: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// editorCommand returns the editor to run from VISUAL or EDITOR, which may
+// include arguments, e.g. `code --wait`.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{defaultEditor}
+}
+
+// editMessage opens the user's editor on a temporary file, and returns the
+// message saved in it once the editor exits.
+func editMessage(in io.Reader, out io.Writer) (string, error) {
+	f, err := os.CreateTemp("", "gh-debug-cli-*.md")
+	if err != nil {
+		return "", fmt.Errorf("could not create message file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("could not create message file: %w", err)
+	}
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running %s: %w", editor[0], err)
+	}
+
+	return readMessageFile(f.Name())
+}
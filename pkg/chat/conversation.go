@@ -0,0 +1,55 @@
+package chat
+
+// Conversation is the history of the messages of a chat session, as sent to
+// the agent with every turn. Only the first choice of a response is kept,
+// until another one is picked.
+type Conversation struct {
+	messages []Message
+
+	// the last response, and where its messages start, so another of its
+	// choices can be picked
+	last  *Response
+	start int
+}
+
+// Messages returns the history to send with the next turn.
+func (c *Conversation) Messages() []Message {
+	return c.messages
+}
+
+// AddUser appends a user message.
+func (c *Conversation) AddUser(content string) {
+	c.messages = append(c.messages, Message{Role: "user", Content: content})
+}
+
+// DropLast removes the last message, e.g. the user message of a turn that
+// failed, so the user can try again.
+func (c *Conversation) DropLast() {
+	if n := len(c.messages); n > 0 {
+		// later appends must not overwrite the messages already returned
+		c.messages = c.messages[: n-1 : n-1]
+	}
+}
+
+// AddResponse appends the messages of the first choice of a response.
+func (c *Conversation) AddResponse(resp *Response) {
+	if resp == nil {
+		return
+	}
+
+	c.last = resp
+	c.start = len(c.messages)
+	if choices := responseChoices(resp); len(choices) > 0 {
+		c.messages = append(c.messages, historyMessages(resp.Messages, choices[0])...)
+	}
+}
+
+// PickChoice replaces the messages of the last response with those of another
+// of its choices, and reports whether the last response has that choice.
+func (c *Conversation) PickChoice(choice int) bool {
+	if !hasChoice(c.last, choice) {
+		return false
+	}
+	c.messages = append(c.messages[:c.start:c.start], historyMessages(c.last.Messages, choice)...)
+	return true
+}
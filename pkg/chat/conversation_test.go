@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversation(t *testing.T) {
+	resp := &Response{
+		Messages: []*Message{
+			{Role: "assistant", Content: "ahoy"},
+			{Role: "assistant", Content: "avast", Metadata: &MessageMetadata{Index: 1}},
+		},
+	}
+
+	var c Conversation
+	c.AddUser("hello")
+	c.AddResponse(resp)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "ahoy"},
+	}, c.Messages())
+
+	sent := c.Messages()
+	assert.False(t, c.PickChoice(2))
+	assert.True(t, c.PickChoice(1))
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "avast"},
+	}, c.Messages())
+	assert.Equal(t, "ahoy", sent[1].Content, "the messages already sent are not overwritten")
+
+	c.AddUser("thanks")
+	c.DropLast()
+	assert.Len(t, c.Messages(), 2)
+
+	c.AddResponse(nil)
+	assert.Len(t, c.Messages(), 2)
+}
@@ -0,0 +1,263 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FailureKind classifies why an agent rejected a request.
+type FailureKind string
+
+const (
+	FailureUnknown           FailureKind = "unknown"
+	FailureSignatureRejected FailureKind = "signature_rejected"
+	FailureTokenInvalid      FailureKind = "token_invalid"
+	FailureUnauthorized      FailureKind = "unauthorized"
+	FailureRouteNotFound     FailureKind = "route_not_found"
+	FailureMethodNotAllowed  FailureKind = "method_not_allowed"
+	FailureServerError       FailureKind = "server_error"
+)
+
+// maxErrorBody is the maximum number of body bytes kept on an HTTPError.
+const maxErrorBody = 64 * 1024
+
+// relevantHeaders are the response headers shown when an agent responds with
+// a non-2xx status.
+var relevantHeaders = []string{
+	"Content-Type",
+	"WWW-Authenticate",
+	"Retry-After",
+	"X-GitHub-Request-Id",
+	"X-Request-Id",
+	"Server",
+}
+
+// HTTPError is returned when the agent responds with a non-2xx status code.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	Kind       FailureKind
+}
+
+func newHTTPError(resp *http.Response, body []byte) *HTTPError {
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+		Kind:       classifyFailure(resp.StatusCode, body),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Kind == FailureUnknown {
+		return fmt.Sprintf("agent responded with %s", e.Status)
+	}
+	return fmt.Sprintf("agent responded with %s (%s)", e.Status, strings.ReplaceAll(string(e.Kind), "_", " "))
+}
+
+// Details describes the failed response, including its relevant headers, its
+// body and a hint on how to fix the most common failures.
+func (e *HTTPError) Details() string {
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("\nAlas...%s\n", e.Error()))
+
+	for _, name := range relevantHeaders {
+		if v := e.Header.Get(name); v != "" {
+			msg.WriteString(fmt.Sprintf("%s: %s\n", name, v))
+		}
+	}
+
+	if len(e.Body) > 0 {
+		msg.WriteString(fmt.Sprintf("\n%s\n", prettyBody(e.Body)))
+	}
+
+	if hint := e.hint(); hint != "" {
+		msg.WriteString(fmt.Sprintf("\n%s\n", hint))
+	}
+
+	return msg.String()
+}
+
+func (e *HTTPError) hint() string {
+	switch e.Kind {
+	case FailureSignatureRejected:
+		return "The agent rejected the payload signature. Temporarily disable payload verification for local testing."
+	case FailureTokenInvalid:
+		return "The agent rejected the GitHub token. Check the value passed with --token."
+	case FailureUnauthorized:
+		return "The agent rejected the request. If it verifies payload signatures, temporarily disable verification for local testing, and check the value passed with --token."
+	case FailureRouteNotFound:
+		return "The agent has no route at this url. Check the path passed with --url."
+	case FailureMethodNotAllowed:
+		return "The agent route does not accept POST requests. Check the path passed with --url."
+	case FailureServerError:
+		return "The agent failed to handle the request. Check the agent logs."
+	default:
+		return ""
+	}
+}
+
+func classifyFailure(statusCode int, body []byte) FailureKind {
+	lower := strings.ToLower(string(body))
+
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		switch {
+		case strings.Contains(lower, "signature") || strings.Contains(lower, "public key") || strings.Contains(lower, "verif"):
+			return FailureSignatureRejected
+		case strings.Contains(lower, "token"):
+			return FailureTokenInvalid
+		default:
+			return FailureUnauthorized
+		}
+	case statusCode == http.StatusNotFound:
+		return FailureRouteNotFound
+	case statusCode == http.StatusMethodNotAllowed:
+		return FailureMethodNotAllowed
+	case statusCode >= 500:
+		return FailureServerError
+	default:
+		return FailureUnknown
+	}
+}
+
+// prettyBody indents JSON bodies and returns any other body as is.
+func prettyBody(body []byte) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err == nil {
+		return out.String()
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// ErrStalled is the cause of an InterruptedError when the agent stopped
+// sending data for longer than the idle timeout.
+var ErrStalled = errors.New("agent stopped sending data")
+
+// InterruptedError is returned when a turn is cut short before the agent
+// finished streaming its response, either because it stalled, the request
+// timed out or the user cancelled it.
+type InterruptedError struct {
+	Cause       error
+	IdleTimeout time.Duration
+	Bytes       int64
+	Tail        []byte
+	Messages    []*Message
+}
+
+func (e *InterruptedError) Error() string {
+	switch {
+	case errors.Is(e.Cause, ErrStalled):
+		return fmt.Sprintf("agent sent no data for %s", e.IdleTimeout)
+	case errors.Is(e.Cause, context.DeadlineExceeded):
+		return "agent did not finish responding before the request timed out"
+	case errors.Is(e.Cause, context.Canceled):
+		return "request cancelled"
+	default:
+		return fmt.Sprintf("request interrupted: %v", e.Cause)
+	}
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Cause
+}
+
+// Details describes what was received before the turn was cut short.
+func (e *InterruptedError) Details() string {
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("\nAlas...%s\n", e.Error()))
+
+	if e.Bytes == 0 {
+		msg.WriteString("No response data was received.\n")
+		return msg.String()
+	}
+
+	msg.WriteString(fmt.Sprintf("Received %d bytes before the stream stopped", e.Bytes))
+	if int64(len(e.Tail)) < e.Bytes {
+		msg.WriteString(fmt.Sprintf(", the last %d were:\n", len(e.Tail)))
+	} else {
+		msg.WriteString(":\n")
+	}
+	msg.WriteString(fmt.Sprintf("%s\n", e.Tail))
+
+	return msg.String()
+}
+
+// Exit codes of a session that sends a single message.
+const (
+	ExitOK = 0
+
+	// ExitUsage is returned for invalid flags or input.
+	ExitUsage = 1
+
+	// ExitTransportError is returned when the agent could not be reached, or
+	// the response was cut short.
+	ExitTransportError = 2
+
+	// ExitHTTPError is returned when the agent responded with a non-2xx status.
+	ExitHTTPError = 3
+
+	// ExitProtocolError is returned when the response broke a rule with the
+	// error severity.
+	ExitProtocolError = 4
+
+	// ExitAgentError is returned when the agent sent copilot_errors.
+	ExitAgentError = 5
+)
+
+// ExitError is returned by a session that sends a single message when the
+// turn failed, with the exit code telling why. The turn has already been
+// displayed.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// turnExitError returns an ExitError when the turn that got resp and err
+// failed, or nil. Protocol errors take precedence over the errors the agent
+// reported, since they may not reach the user at all.
+func turnExitError(resp *Response, err error) error {
+	var httpErr *HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return &ExitError{Code: ExitHTTPError, Err: err}
+	case err != nil:
+		return &ExitError{Code: ExitTransportError, Err: err}
+	}
+
+	var broken int
+	for _, v := range resp.Violations {
+		if v.Severity == SeverityError {
+			broken++
+		}
+	}
+	if broken > 0 {
+		return &ExitError{Code: ExitProtocolError, Err: fmt.Errorf("the response broke %d protocol rules", broken)}
+	}
+
+	var reported int
+	for _, msg := range resp.Messages {
+		reported += len(msg.Errors)
+	}
+	if reported > 0 {
+		return &ExitError{Code: ExitAgentError, Err: fmt.Errorf("the agent reported %d errors", reported)}
+	}
+	return nil
+}
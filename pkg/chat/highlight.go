@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// syntax is what the code highlighter knows about a language.
+type syntax struct {
+	keywords map[string]bool
+	comment  string
+	quotes   string
+}
+
+func newSyntax(comment string, quotes string, keywords string) *syntax {
+	s := &syntax{keywords: map[string]bool{}, comment: comment, quotes: quotes}
+	for _, k := range strings.Fields(keywords) {
+		s.keywords[k] = true
+	}
+	return s
+}
+
+var (
+	goSyntax = newSyntax("//", "\"'`", `break case chan const continue default defer else fallthrough for func go goto
+		if import interface map package range return select struct switch type var nil true false`)
+	jsSyntax = newSyntax("//", "\"'`", `async await break case catch class const continue default delete do else export
+		extends finally for from function if import in instanceof interface let new null of return static super
+		switch this throw true false try type typeof undefined var void while yield`)
+	pySyntax = newSyntax("#", "\"'", `and as assert async await break class continue def del elif else except False
+		finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield`)
+	shSyntax = newSyntax("#", "\"'", `case do done elif else esac export fi for function if in local return then
+		until while`)
+	jsonSyntax = newSyntax("", "\"", `true false null`)
+)
+
+// syntaxes maps the language of a code block to its syntax.
+var syntaxes = map[string]*syntax{
+	"go":         goSyntax,
+	"golang":     goSyntax,
+	"js":         jsSyntax,
+	"javascript": jsSyntax,
+	"ts":         jsSyntax,
+	"typescript": jsSyntax,
+	"py":         pySyntax,
+	"python":     pySyntax,
+	"sh":         shSyntax,
+	"bash":       shSyntax,
+	"shell":      shSyntax,
+	"json":       jsonSyntax,
+}
+
+// renderCodeBlock renders the lines of a fenced code block, highlighting the
+// languages the highlighter knows.
+func renderCodeBlock(lang string, code []string, c Colors) []string {
+	out := []string{"┌─ " + lang}
+	syn := syntaxes[strings.ToLower(lang)]
+	for _, line := range code {
+		if syn != nil {
+			line = syn.highlight(line, c)
+		}
+		out = append(out, "│ "+line)
+	}
+	return append(out, "└─")
+}
+
+// highlight colors the keywords, strings, numbers and comments of a line.
+// Strings and comments spanning lines are not tracked.
+func (s *syntax) highlight(line string, c Colors) string {
+	var out strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case s.comment != "" && strings.HasPrefix(string(runes[i:]), s.comment):
+			out.WriteString(c.commentColor(string(runes[i:])))
+			return out.String()
+
+		case strings.ContainsRune(s.quotes, r):
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			out.WriteString(c.stringColor(string(runes[i : j+1])))
+			i = j + 1
+
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == '_') {
+				j++
+			}
+			out.WriteString(c.numberColor(string(runes[i:j])))
+			i = j
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			word := string(runes[i:j])
+			if s.keywords[word] {
+				word = c.keywordColor(word)
+			}
+			out.WriteString(word)
+			i = j
+
+		default:
+			out.WriteRune(r)
+			i++
+		}
+	}
+	return out.String()
+}
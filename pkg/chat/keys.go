@@ -0,0 +1,125 @@
+package chat
+
+import "bufio"
+
+// tuiKey is a key read from a terminal in raw mode. Rune is only set for
+// keyRune.
+type tuiKey struct {
+	code keyCode
+	r    rune
+}
+
+type keyCode int
+
+const (
+	keyUnknown keyCode = iota
+	keyRune
+	keyEnter
+	keyBackspace
+	keyTab
+	keyEsc
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyCtrlA
+	keyCtrlC
+	keyCtrlD
+	keyCtrlE
+	keyCtrlG
+	keyCtrlK
+	keyCtrlL
+	keyCtrlN
+	keyCtrlP
+	keyCtrlR
+	keyCtrlU
+	keyCtrlW
+)
+
+// escapeKeys maps the escape sequences sent by terminals, minus the leading
+// ESC [ or ESC O, to keys.
+var escapeKeys = map[string]keyCode{
+	"A":  keyUp,
+	"B":  keyDown,
+	"C":  keyRight,
+	"D":  keyLeft,
+	"3~": keyDelete,
+	"5~": keyPageUp,
+	"6~": keyPageDown,
+	"H":  keyHome,
+	"1~": keyHome,
+	"F":  keyEnd,
+	"4~": keyEnd,
+}
+
+// readKey reads a key from a terminal in raw mode.
+func readKey(r *bufio.Reader) (tuiKey, error) {
+	ch, _, err := r.ReadRune()
+	if err != nil {
+		return tuiKey{}, err
+	}
+
+	switch ch {
+	case '\r', '\n':
+		return tuiKey{code: keyEnter}, nil
+	case 127, '\b':
+		return tuiKey{code: keyBackspace}, nil
+	case '\t':
+		return tuiKey{code: keyTab}, nil
+	case 1:
+		return tuiKey{code: keyCtrlA}, nil
+	case 3:
+		return tuiKey{code: keyCtrlC}, nil
+	case 4:
+		return tuiKey{code: keyCtrlD}, nil
+	case 5:
+		return tuiKey{code: keyCtrlE}, nil
+	case 7:
+		return tuiKey{code: keyCtrlG}, nil
+	case 11:
+		return tuiKey{code: keyCtrlK}, nil
+	case 12:
+		return tuiKey{code: keyCtrlL}, nil
+	case 14:
+		return tuiKey{code: keyCtrlN}, nil
+	case 16:
+		return tuiKey{code: keyCtrlP}, nil
+	case 18:
+		return tuiKey{code: keyCtrlR}, nil
+	case 21:
+		return tuiKey{code: keyCtrlU}, nil
+	case 23:
+		return tuiKey{code: keyCtrlW}, nil
+	case 0x1b:
+		// a lone ESC is not followed by the rest of a sequence
+		if r.Buffered() == 0 {
+			return tuiKey{code: keyEsc}, nil
+		}
+		if next, err := r.ReadByte(); err != nil || (next != '[' && next != 'O') {
+			return tuiKey{code: keyUnknown}, err
+		}
+
+		var seq []byte
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return tuiKey{}, err
+			}
+			seq = append(seq, b)
+			if b >= 0x40 && b <= 0x7e {
+				break
+			}
+		}
+		return tuiKey{code: escapeKeys[string(seq)]}, nil
+	}
+
+	if ch < ' ' {
+		return tuiKey{code: keyUnknown}, nil
+	}
+	return tuiKey{code: keyRune, r: ch}, nil
+}
@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []tuiKey
+	}{
+		{
+			name:     "runes",
+			input:    "hé",
+			expected: []tuiKey{{code: keyRune, r: 'h'}, {code: keyRune, r: 'é'}},
+		},
+		{
+			name:     "control_keys",
+			input:    "\r\x7f\t\x01\x03\x04\x05\x07\x0b\x0c\x0e\x10\x12\x15\x17",
+			expected: []tuiKey{{code: keyEnter}, {code: keyBackspace}, {code: keyTab}, {code: keyCtrlA}, {code: keyCtrlC}, {code: keyCtrlD}, {code: keyCtrlE}, {code: keyCtrlG}, {code: keyCtrlK}, {code: keyCtrlL}, {code: keyCtrlN}, {code: keyCtrlP}, {code: keyCtrlR}, {code: keyCtrlU}, {code: keyCtrlW}},
+		},
+		{
+			name:     "escape_sequences",
+			input:    "\x1b[A\x1b[B\x1b[C\x1b[D\x1b[3~\x1b[5~\x1b[6~\x1bOH\x1b[4~\x1b[1;5C",
+			expected: []tuiKey{{code: keyUp}, {code: keyDown}, {code: keyRight}, {code: keyLeft}, {code: keyDelete}, {code: keyPageUp}, {code: keyPageDown}, {code: keyHome}, {code: keyEnd}, {code: keyUnknown}},
+		},
+		{
+			name:     "lone_escape",
+			input:    "\x1b",
+			expected: []tuiKey{{code: keyEsc}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			var keys []tuiKey
+			for range tt.expected {
+				k, err := readKey(r)
+				require.NoError(t, err)
+				keys = append(keys, k)
+			}
+			assert.Equal(t, tt.expected, keys)
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package chat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alexeyco/simpletable"
+)
+
+var (
+	mdFence     = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	mdHeading   = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRule      = regexp.MustCompile(`^\s{0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	mdQuote     = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	mdBullet    = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdOrdered   = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	mdTask      = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	mdTableSep  = regexp.MustCompile(`^\s*(\|\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?|:?-+:?\s*((\|\s*:?-+:?\s*)+\|?|\|))\s*$`)
+	mdImage     = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	mdLink      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdBold      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic    = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	mdStrike    = regexp.MustCompile(`~~([^~]+)~~`)
+	mdHTML      = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9]*)(\s[^<>]*)?/?>`)
+	mdFootnote  = regexp.MustCompile(`\[\^[^\]]+\]`)
+	mdMathBlock = regexp.MustCompile(`^\s*\$\$\s*$|\$\$[^$\s]([^$]*[^$\s])?\$\$`)
+)
+
+// htmlElements are the names of the HTML elements flagged as raw HTML, so
+// generics such as Vec<T> and comparisons are not.
+var htmlElements = map[string]bool{
+	"a": true, "abbr": true, "article": true, "aside": true, "audio": true, "b": true, "blockquote": true,
+	"br": true, "button": true, "caption": true, "center": true, "cite": true, "code": true, "col": true,
+	"colgroup": true, "dd": true, "del": true, "details": true, "dfn": true, "div": true, "dl": true,
+	"dt": true, "em": true, "embed": true, "figcaption": true, "figure": true, "font": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "i": true, "iframe": true, "img": true, "input": true, "ins": true, "kbd": true,
+	"label": true, "li": true, "main": true, "mark": true, "nav": true, "object": true, "ol": true,
+	"option": true, "p": true, "picture": true, "pre": true, "q": true, "s": true, "samp": true,
+	"script": true, "section": true, "select": true, "small": true, "source": true, "span": true,
+	"strike": true, "strong": true, "style": true, "sub": true, "summary": true, "sup": true, "svg": true,
+	"table": true, "tbody": true, "td": true, "textarea": true, "tfoot": true, "th": true, "thead": true,
+	"time": true, "tr": true, "u": true, "ul": true, "var": true, "video": true,
+}
+
+// RenderMarkdown renders markdown for the terminal: headings, lists, quotes,
+// tables, links, inline styles and code blocks with syntax highlighting.
+func RenderMarkdown(src string, c Colors) string {
+	lines := strings.Split(strings.TrimRight(src, "\n"), "\n")
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			fence, lang := m[1], m[2]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			out = append(out, renderCodeBlock(lang, code, c)...)
+			continue
+		}
+
+		if strings.Contains(line, "|") && i+1 < len(lines) && mdTableSep.MatchString(lines[i+1]) {
+			rows := [][]string{splitTableRow(line)}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|"); i++ {
+				rows = append(rows, splitTableRow(lines[i]))
+			}
+			i--
+			out = append(out, renderTable(rows))
+			continue
+		}
+
+		switch {
+		case mdHeading.MatchString(line):
+			m := mdHeading.FindStringSubmatch(line)
+			text := renderInline(m[2], c)
+			if len(m[1]) == 1 {
+				text = strings.ToUpper(text)
+			}
+			out = append(out, c.bold(c.headingColor(text)))
+
+		case mdRule.MatchString(line):
+			out = append(out, strings.Repeat("─", 40))
+
+		case mdQuote.MatchString(line):
+			m := mdQuote.FindStringSubmatch(line)
+			out = append(out, "│ "+c.italic(renderInline(m[1], c)))
+
+		case mdBullet.MatchString(line):
+			m := mdBullet.FindStringSubmatch(line)
+			bullet, text := "•", m[2]
+			if t := mdTask.FindStringSubmatch(text); t != nil {
+				bullet, text = "☐", t[2]
+				if t[1] != " " {
+					bullet = "☑"
+				}
+			}
+			out = append(out, fmt.Sprintf("%s  %s %s", m[1], bullet, renderInline(text, c)))
+
+		case mdOrdered.MatchString(line):
+			m := mdOrdered.FindStringSubmatch(line)
+			out = append(out, fmt.Sprintf("%s  %s. %s", m[1], m[2], renderInline(m[3], c)))
+
+		default:
+			out = append(out, renderInline(line, c))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// renderInline renders the inline styles of a line, leaving code spans as
+// they are written.
+func renderInline(s string, c Colors) string {
+	parts := strings.Split(s, "`")
+	for i, part := range parts {
+		// parts at odd indexes are inside a code span, unless the span is not
+		// closed
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = c.codeColor(part)
+			continue
+		}
+
+		part = mdImage.ReplaceAllString(part, "[image: $1] ($2)")
+		part = mdLink.ReplaceAllStringFunc(part, func(link string) string {
+			m := mdLink.FindStringSubmatch(link)
+			return fmt.Sprintf("%s (%s)", c.underline(m[1]), m[2])
+		})
+		part = mdBold.ReplaceAllStringFunc(part, func(b string) string {
+			m := mdBold.FindStringSubmatch(b)
+			return c.bold(m[1] + m[2])
+		})
+		part = mdItalic.ReplaceAllStringFunc(part, func(it string) string {
+			m := mdItalic.FindStringSubmatch(it)
+			return c.italic(m[1] + m[2])
+		})
+		part = mdStrike.ReplaceAllStringFunc(part, func(st string) string {
+			return c.strike(mdStrike.FindStringSubmatch(st)[1])
+		})
+		parts[i] = part
+	}
+
+	// an unclosed code span keeps its backtick
+	if len(parts)%2 == 0 {
+		last := len(parts) - 1
+		parts[last-1] += "`" + parts[last]
+		parts = parts[:last]
+	}
+	return strings.Join(parts, "")
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+	return cells
+}
+
+// renderTable renders the header row and body rows of a markdown table.
+// Inline styles are left out since simpletable pads cells by their bytes.
+func renderTable(rows [][]string) string {
+	table := simpletable.New()
+
+	width := len(rows[0])
+	cellsOf := func(row []string) []*simpletable.Cell {
+		cells := make([]*simpletable.Cell, width)
+		for i := range cells {
+			cells[i] = &simpletable.Cell{}
+			if i < len(row) {
+				cells[i].Text = row[i]
+			}
+		}
+		return cells
+	}
+
+	table.Header = &simpletable.Header{Cells: cellsOf(rows[0])}
+	var body [][]*simpletable.Cell
+	for _, row := range rows[1:] {
+		body = append(body, cellsOf(row))
+	}
+	table.Body = &simpletable.Body{Cells: body}
+
+	table.SetStyle(simpletable.StyleUnicode)
+	return table.String()
+}
+
+// MarkdownIssue is a markdown construct Copilot Chat does not render.
+type MarkdownIssue struct {
+	Line      int    `json:"line"`
+	Construct string `json:"construct"`
+	Text      string `json:"text"`
+}
+
+func (i MarkdownIssue) String() string {
+	return fmt.Sprintf("line %d: %s %s", i.Line, i.Construct, i.Text)
+}
+
+// UnsupportedMarkdown returns the markdown constructs in src that Copilot
+// Chat does not render: raw HTML, images, footnotes and math blocks. Code
+// blocks and code spans are skipped.
+func UnsupportedMarkdown(src string) []MarkdownIssue {
+	checks := []struct {
+		construct string
+		re        *regexp.Regexp
+		// valid reports whether a match is the construct, when not every
+		// match is
+		valid func(m []string) bool
+	}{
+		{"html", mdHTML, func(m []string) bool { return htmlElements[strings.ToLower(m[1])] }},
+		{"image", mdImage, nil},
+		{"footnote", mdFootnote, nil},
+		{"math", mdMathBlock, nil},
+	}
+
+	var issues []MarkdownIssue
+	var fence string
+	for i, line := range strings.Split(src, "\n") {
+		if m := mdFence.FindStringSubmatch(line); m != nil && (fence == "" || strings.HasPrefix(m[1], fence)) {
+			if fence == "" {
+				fence = m[1]
+			} else {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+
+		// code spans are shown as they are written
+		text := stripCodeSpans(line)
+		for _, check := range checks {
+			for _, m := range check.re.FindAllStringSubmatch(text, -1) {
+				if check.valid != nil && !check.valid(m) {
+					continue
+				}
+				issues = append(issues, MarkdownIssue{Line: i + 1, Construct: check.construct, Text: m[0]})
+			}
+		}
+	}
+	return issues
+}
+
+// stripCodeSpans drops the code spans of a line: a run of backticks up to the
+// next run of as many backticks. Backticks that open no span are kept.
+func stripCodeSpans(line string) string {
+	var text strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			text.WriteString(line)
+			return text.String()
+		}
+		n := backtickRun(line[start:])
+		text.WriteString(line[:start])
+		rest := line[start+n:]
+
+		end := -1
+		for i := 0; i < len(rest); {
+			if rest[i] != '`' {
+				i++
+				continue
+			}
+			run := backtickRun(rest[i:])
+			if run == n {
+				end = i
+				break
+			}
+			i += run
+		}
+		if end < 0 {
+			text.WriteString(line[start : start+n])
+			line = rest
+			continue
+		}
+		line = rest[end+n:]
+	}
+}
+
+// backtickRun returns the number of backticks s starts with.
+func backtickRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '`' {
+		n++
+	}
+	return n
+}
+
+// markdownIssuesOutput lists the markdown constructs of a message Copilot Chat
+// does not render.
+func markdownIssuesOutput(issues []MarkdownIssue, c Colors) string {
+	if len(issues) == 0 {
+		return ""
+	}
+
+	var msg strings.Builder
+	msg.WriteString(c.warningColor("Copilot Chat does not render some of the markdown in this message:\n"))
+	for _, issue := range issues {
+		msg.WriteString(c.warningColor(issue.String()) + "\n")
+	}
+	return msg.String()
+}
@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{
+			name:     "heading",
+			markdown: "# Ahoy\n## Matey",
+			expected: DefaultColors.bold(DefaultColors.headingColor("AHOY")) + "\n" + DefaultColors.bold(DefaultColors.headingColor("Matey")),
+		},
+		{
+			name:     "inline",
+			markdown: "**bold**, *italic*, ~~gone~~ and `**code**` in [the docs](https://docs.github.com)",
+			expected: DefaultColors.bold("bold") + ", " + DefaultColors.italic("italic") + ", " + DefaultColors.strike("gone") + " and " + DefaultColors.codeColor("**code**") + " in " + DefaultColors.underline("the docs") + " (https://docs.github.com)",
+		},
+		{
+			name:     "unclosed_code_span",
+			markdown: "a `b",
+			expected: "a `b",
+		},
+		{
+			name:     "lists",
+			markdown: "- one\n  - two\n- [x] done\n- [ ] todo\n1. first",
+			expected: "  • one\n    • two\n  ☑ done\n  ☐ todo\n  1. first",
+		},
+		{
+			name:     "quote",
+			markdown: "> avast",
+			expected: "│ " + DefaultColors.italic("avast"),
+		},
+		{
+			name:     "code_block",
+			markdown: "```go\nreturn \"ahoy\", 42 // done\n```",
+			expected: "┌─ go\n│ " + DefaultColors.keywordColor("return") + " " + DefaultColors.stringColor(`"ahoy"`) + ", " + DefaultColors.numberColor("42") + " " + DefaultColors.commentColor("// done") + "\n└─",
+		},
+		{
+			name:     "code_block_unknown_language",
+			markdown: "```\nreturn **x**\n```",
+			expected: "┌─ \n│ return **x**\n└─",
+		},
+		{
+			name:     "table",
+			markdown: "| a | b |\n|---|---|\n| 1 | 22 |",
+			expected: "╔═══╤════╗\n║ a │ b  ║\n╟━━━┼━━━━╢\n║ 1 │ 22 ║\n╚═══╧════╝",
+		},
+		{
+			name:     "table_without_outer_pipes",
+			markdown: "a | b\n--- | ---\n1 | 22",
+			expected: "╔═══╤════╗\n║ a │ b  ║\n╟━━━┼━━━━╢\n║ 1 │ 22 ║\n╚═══╧════╝",
+		},
+		{
+			name:     "rule_after_pipe_is_not_a_table",
+			markdown: "a | b\n---",
+			expected: "a | b\n" + strings.Repeat("─", 40),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, RenderMarkdown(tt.markdown, DefaultColors))
+		})
+	}
+}
+
+func TestRenderMarkdown_Theme(t *testing.T) {
+	colors := DefaultColors
+	colors.Theme.Heading = ColorRed
+	colors.Theme.Keyword = ColorGreen
+
+	assert.Equal(t, colors.bold(colors.red("Ahoy")), RenderMarkdown("## Ahoy", colors))
+	assert.Equal(t, "┌─ go\n│ "+colors.green("return")+"\n└─", RenderMarkdown("```go\nreturn\n```", colors))
+}
+
+func TestUnsupportedMarkdown(t *testing.T) {
+	markdown := "<details>ahoy</details>\n`<b>` is fine\n```html\n<p>so is this</p>\n```\n![parrot](parrot.png) [^1] $$x^2$$"
+
+	assert.Equal(t, []MarkdownIssue{
+		{Line: 1, Construct: "html", Text: "<details>"},
+		{Line: 1, Construct: "html", Text: "</details>"},
+		{Line: 6, Construct: "image", Text: "![parrot](parrot.png)"},
+		{Line: 6, Construct: "footnote", Text: "[^1]"},
+		{Line: 6, Construct: "math", Text: "$$x^2$$"},
+	}, UnsupportedMarkdown(markdown))
+}
+
+func TestUnsupportedMarkdown_Supported(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+	}{
+		{name: "code_span", markdown: "use `<div>` and `$$x$$` here"},
+		{name: "double_backtick_code_span", markdown: "use ``<div>`<br>`` here"},
+		{name: "code_fence", markdown: "```\n<div>\n![parrot](parrot.png)\n$$\n```"},
+		{name: "tilde_fence", markdown: "~~~go\nvar m map[string]int // [^1]\n~~~"},
+		{name: "generics", markdown: "a Vec<T> or a List<String>"},
+		{name: "comparison", markdown: "when a < b and c > d, or 1<2 and 3>0"},
+		{name: "autolink", markdown: "see <https://github.com>"},
+		{name: "dollars", markdown: "it costs $$5, or $$ 10 $$ with tax"},
+		{name: "shell_pid", markdown: "echo $$ prints the pid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Empty(t, UnsupportedMarkdown(tt.markdown))
+		})
+	}
+}
+
+func TestUnsupportedMarkdown_UnclosedCodeSpan(t *testing.T) {
+	assert.Equal(t, []MarkdownIssue{
+		{Line: 1, Construct: "html", Text: "<br>"},
+	}, UnsupportedMarkdown("a ` and a<br>"))
+}
+
+func TestUnsupportedMarkdown_MathBlock(t *testing.T) {
+	assert.Equal(t, []MarkdownIssue{
+		{Line: 1, Construct: "math", Text: "$$"},
+		{Line: 3, Construct: "math", Text: "  $$"},
+	}, UnsupportedMarkdown("$$\nx^2\n  $$"))
+}
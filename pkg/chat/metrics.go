@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alexeyco/simpletable"
+)
+
+// Metrics holds the latency and throughput of a single turn.
+type Metrics struct {
+	TimeToHeaders    time.Duration `json:"time_to_headers"`
+	TimeToFirstEvent time.Duration `json:"time_to_first_event"`
+	TimeToFirstToken time.Duration `json:"time_to_first_token"`
+	Duration         time.Duration `json:"duration"`
+	Chunks           int           `json:"chunks"`
+	Bytes            int64         `json:"bytes"`
+	GapP50           time.Duration `json:"gap_p50"`
+	GapP90           time.Duration `json:"gap_p90"`
+	GapP99           time.Duration `json:"gap_p99"`
+}
+
+// metricsRecorder collects the timings of a turn as its response streams in.
+type metricsRecorder struct {
+	start      time.Time
+	headers    time.Time
+	firstToken time.Time
+	events     []time.Time
+}
+
+func newMetricsRecorder() *metricsRecorder {
+	return &metricsRecorder{start: time.Now()}
+}
+
+func (r *metricsRecorder) GotHeaders() {
+	r.headers = time.Now()
+}
+
+func (r *metricsRecorder) GotEvent() {
+	r.events = append(r.events, time.Now())
+}
+
+func (r *metricsRecorder) GotToken() {
+	if r.firstToken.IsZero() {
+		r.firstToken = time.Now()
+	}
+}
+
+// Metrics computes the metrics of the turn, given the number of response bytes
+// received.
+func (r *metricsRecorder) Metrics(bytes int64) Metrics {
+	m := Metrics{
+		Duration: time.Since(r.start),
+		Chunks:   len(r.events),
+		Bytes:    bytes,
+	}
+
+	if !r.headers.IsZero() {
+		m.TimeToHeaders = r.headers.Sub(r.start)
+	}
+	if len(r.events) > 0 {
+		m.TimeToFirstEvent = r.events[0].Sub(r.start)
+	}
+	if !r.firstToken.IsZero() {
+		m.TimeToFirstToken = r.firstToken.Sub(r.start)
+	}
+
+	var gaps []time.Duration
+	for i := 1; i < len(r.events); i++ {
+		gaps = append(gaps, r.events[i].Sub(r.events[i-1]))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	m.GapP50 = Percentile(gaps, 50)
+	m.GapP90 = Percentile(gaps, 90)
+	m.GapP99 = Percentile(gaps, 99)
+
+	return m
+}
+
+// Percentile returns the p-th percentile of the sorted durations, using the
+// nearest-rank method.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func (m Metrics) String() string {
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignLeft, Text: "Metric"},
+			{Align: simpletable.AlignLeft, Text: "Value"},
+		},
+	}
+
+	cells := [][]*simpletable.Cell{
+		{{Text: "time to headers"}, {Text: FormatDuration(m.TimeToHeaders)}},
+		{{Text: "time to first event"}, {Text: FormatDuration(m.TimeToFirstEvent)}},
+		{{Text: "time to first token"}, {Text: FormatDuration(m.TimeToFirstToken)}},
+		{{Text: "total duration"}, {Text: FormatDuration(m.Duration)}},
+		{{Text: "chunks"}, {Text: fmt.Sprintf("%d", m.Chunks)}},
+		{{Text: "bytes"}, {Text: fmt.Sprintf("%d", m.Bytes)}},
+		{{Text: "chunk gap p50 / p90 / p99"}, {Text: fmt.Sprintf("%s / %s / %s", FormatDuration(m.GapP50), FormatDuration(m.GapP90), FormatDuration(m.GapP99))}},
+	}
+	table.Body = &simpletable.Body{Cells: cells}
+
+	table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+		{Align: simpletable.AlignRight, Span: 2, Text: "Turn metrics"},
+	}}
+
+	table.SetStyle(simpletable.StyleUnicode)
+	return fmt.Sprintf("%s\n", table.String())
+}
+
+// FormatDuration formats a duration for the metrics tables, rounded to the
+// microsecond below a millisecond and to the millisecond above.
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "-"
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
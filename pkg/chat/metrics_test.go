@@ -0,0 +1,35 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		name     string
+		sorted   []time.Duration
+		p        float64
+		expected time.Duration
+	}{
+		{name: "empty", sorted: nil, p: 50, expected: 0},
+		{name: "single", sorted: []time.Duration{time.Second}, p: 99, expected: time.Second},
+		{name: "p50", sorted: sorted, p: 50, expected: 50 * time.Millisecond},
+		{name: "p90", sorted: sorted, p: 90, expected: 90 * time.Millisecond},
+		{name: "p99", sorted: sorted, p: 99, expected: 99 * time.Millisecond},
+		{name: "p100", sorted: sorted, p: 100, expected: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Percentile(tt.sorted, tt.p))
+		})
+	}
+}
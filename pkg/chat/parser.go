@@ -1,11 +1,13 @@
 package chat
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/jclem/sseparser"
@@ -14,244 +16,485 @@ import (
 const (
 	sseDataField  = "data"
 	sseEventField = "event"
+	sseIDField    = "id"
+	sseRetryField = "retry"
 )
 
+// ParseMode sets how closely a stream must follow what Copilot clients
+// expect.
+type ParseMode string
+
+const (
+	// ParseModeLenient accepts any stream that is valid per the SSE spec, the
+	// way browsers do, and reports the parts Copilot ignores as warnings.
+	ParseModeLenient ParseMode = "lenient"
+
+	// ParseModeStrict rejects anything beyond the subset of SSE Copilot
+	// clients read: single line `event` and `data` fields.
+	ParseModeStrict ParseMode = "strict"
+)
+
+// strictRules are the rules raised from warnings to errors in strict mode.
+var strictRules = map[string]bool{
+	RuleSSEUnsupportedField:  true,
+	RuleSSEMultilineData:     true,
+	RuleEventUnsupportedType: true,
+	RuleEventMissingType:     true,
+}
+
 type dataEmitter func(data any)
 
 // Parser is a parser for ServerSent Events (SSE).
 type Parser struct {
 	buf        io.Reader
 	fn         dataEmitter
-	eventCount int
+	onEvent    func(raw []byte)
+	mode       ParseMode
+	rules      *RuleSet
+	violations []Violation
+	eventTypes map[string]bool
+	errorIDs   map[string]bool
+	stream     streamState
+
+	// eventIndex is the 1-based index of the event being parsed, and offset
+	// the byte offset it starts at in the stream.
+	eventIndex int
+	offset     int64
 }
 
-// NewParser creates a new SSEParser.
+// NewParser creates a new SSEParser. It parses in lenient mode with the
+// default rules.
 func NewParser(buf io.Reader, fn dataEmitter) *Parser {
 	return &Parser{
 		buf:        buf,
 		fn:         fn,
-		eventCount: 0,
+		mode:       ParseModeLenient,
+		rules:      NewRuleSet(),
+		eventTypes: map[string]bool{},
+		errorIDs:   map[string]bool{},
+		stream:     newStreamState(),
 	}
 }
 
-// ParseAndEmit parses the SSE stream and emits the parsed events.
-func (p *Parser) ParseAndEmit(ctx context.Context, debug string) error {
-	scanner := sseparser.NewStreamScanner(p.buf)
+// SetMode sets the parse mode.
+func (p *Parser) SetMode(mode ParseMode) {
+	p.mode = mode
+}
+
+// SetRules sets the rules checked while parsing.
+func (p *Parser) SetRules(rules *RuleSet) {
+	p.rules = rules
+}
+
+// Violations returns the rules broken by the stream so far.
+func (p *Parser) Violations() []Violation {
+	return p.violations
+}
+
+// OnEvent registers a function called with the raw bytes of every event as
+// soon as it is read from the stream, before it is parsed.
+func (p *Parser) OnEvent(fn func(raw []byte)) {
+	p.onEvent = fn
+}
+
+// rawEvent writes an event back the way it was sent, minus blank lines.
+func rawEvent(event sseparser.Event) []byte {
+	var raw bytes.Buffer
+	for _, item := range event {
+		switch v := item.(type) {
+		case sseparser.Field:
+			fmt.Fprintf(&raw, "%s: %s\n", v.Name, v.Value)
+		case sseparser.Comment:
+			fmt.Fprintf(&raw, ":%s\n", v)
+		}
+	}
+	return raw.Bytes()
+}
+
+// ParseAndEmit parses the SSE stream and emits the parsed events. Parsing
+// goes on past events breaking a rule, so every rule broken by the stream is
+// recorded along with the event it belongs to.
+func (p *Parser) ParseAndEmit(ctx context.Context) error {
+	counter := &countingReader{r: p.buf}
+	scanner := sseparser.NewStreamScanner(counter)
 
 	for {
-		event, _, err := scanner.Next()
+		event, rest, err := scanner.Next()
 		if err != nil {
 			if errors.Is(err, sseparser.ErrStreamEOF) {
-				return nil
+				break
 			}
 			return fmt.Errorf("failed to read from stream: %w", err)
 		}
 
-		eventFields := map[string]string{}
-		dataFields := []string{}
-		for _, field := range event.Fields() {
-			switch field.Name {
-			case sseEventField:
-				eventFields[field.Name] = field.Value
-			case sseDataField:
-				dataFields = append(dataFields, field.Value)
-			default:
-				return fmt.Errorf(red("only 'event' and 'data' fields are supported, found: %s\n\n"), field.Name)
-			}
+		if p.onEvent != nil {
+			p.onEvent(rawEvent(event))
 		}
 
-		switch {
-		case eventFields[sseEventField] == "copilot_confirmation":
-			p.eventCount++
-			err := emitConfirmation(dataFields, p.fn)
-			if err != nil && shouldLog(debug, LEVEL_DEBUG) {
-				return fmt.Errorf(red("\nAlas...The following is not a valid copilot confirmation:\n%v\n\nErrors:\n%v\n\n"), dataFields, err)
-			}
+		p.eventIndex++
+		p.stream.events++
+		p.parseEvent(event)
+		// the scanner reads ahead, so the next event starts where the bytes
+		// read so far minus those left over end
+		p.offset = counter.n - int64(len(rest))
+	}
 
-		case eventFields[sseEventField] == "copilot_references":
-			p.eventCount++
-			err := emitReferences(dataFields, p.fn)
-			if err != nil && shouldLog(debug, LEVEL_DEBUG) {
-				return fmt.Errorf(red("\nAlas...The following is not a valid copilot reference:\n%v\n\nErrors:\n%v\n\n"), dataFields, err)
-			}
+	p.eventIndex = 0
+	if len(p.eventTypes) > 1 {
+		types := make([]string, 0, len(p.eventTypes))
+		for eventType := range p.eventTypes {
+			types = append(types, eventType)
+		}
+		sort.Strings(types)
+		p.report(RuleEventMultipleTypes, "cannot have more than one event type in an invocation, found %d: %s", len(types), strings.Join(types, ", "))
+	}
+	p.checkStreamEnd()
+	return nil
+}
 
-		case eventFields[sseEventField] == "copilot_errors":
-			p.eventCount++
-			err := emitErrors(dataFields, p.fn)
-			if err != nil && shouldLog(debug, LEVEL_DEBUG) {
-				return fmt.Errorf(red("\nAlas...The following is not a valid a copilot error:\n%v\n\nErrors:\n%v\n\n"), dataFields, err)
-			}
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-		case eventFields[sseEventField] != "":
-			if shouldLog(debug, LEVEL_DEBUG) {
-				err := fmt.Errorf("type not supported: %s", eventFields[sseEventField])
-				return fmt.Errorf(red("\nAlas...The following is not a valid event:\n%v\n\nErrors:\n%v\n\n"), dataFields, err)
-			}
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
 
+// report records a violation of a rule, and returns whether the data breaking
+// it can still be emitted.
+func (p *Parser) report(rule string, format string, a ...any) bool {
+	severity := p.rules.Severity(rule)
+	if p.mode == ParseModeStrict && strictRules[rule] && severity == SeverityWarning {
+		severity = SeverityError
+	}
+	if severity == SeverityOff {
+		return true
+	}
+
+	violation := Violation{
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, a...),
+		Event:    p.eventIndex,
+	}
+	if p.eventIndex > 0 {
+		violation.Offset = p.offset
+	}
+	p.violations = append(p.violations, violation)
+	return severity != SeverityError
+}
+
+// parseEvent checks and emits a single event.
+func (p *Parser) parseEvent(event sseparser.Event) {
+	eventFields := map[string]string{}
+	dataFields := []string{}
+	valid := true
+	for _, field := range event.Fields() {
+		switch field.Name {
+		case sseEventField:
+			eventFields[field.Name] = field.Value
+		case sseDataField:
+			dataFields = append(dataFields, field.Value)
+		case sseIDField, sseRetryField:
+			// both are valid SSE fields that have no meaning to Copilot
+			if p.mode == ParseModeStrict {
+				valid = p.report(RuleSSEUnsupportedField, "Copilot Chat ignores the %q field, it only reads `event` and `data`", field.Name) && valid
+			}
 		default:
-			if _, ok := eventFields[sseEventField]; ok && shouldLog(debug, LEVEL_DEBUG) {
-				err := fmt.Errorf("event field must have a type")
-				return fmt.Errorf(red("\nAlas...The following is not a valid event:\n%v\n\nErrors:\n%v\n\n"), dataFields, err)
+			if p.mode == ParseModeStrict {
+				valid = p.report(RuleSSEUnsupportedField, "Copilot Chat ignores the %q field, it only reads `event` and `data`", field.Name) && valid
+			} else {
+				valid = p.report(RuleSSEUnsupportedField, "ignored unknown field %q", field.Name) && valid
 			}
+		}
+	}
+
+	datas, ok := p.joinData(dataFields)
+	if !ok || !valid {
+		return
+	}
+	p.checkAfterDone(datas)
+
+	eventType, hasEventType := eventFields[sseEventField]
+	switch {
+	case eventType == "copilot_confirmation":
+		p.eventTypes[eventType] = true
+		p.emitConfirmation(datas)
+
+	case eventType == "copilot_references":
+		p.eventTypes[eventType] = true
+		p.emitReferences(datas)
+
+	case eventType == "copilot_errors":
+		p.eventTypes[eventType] = true
+		p.emitErrors(datas)
+
+	case eventType != "":
+		if p.mode == ParseModeLenient {
+			p.report(RuleEventUnsupportedType, "ignored unsupported event type %q", eventType)
+		} else {
+			p.report(RuleEventUnsupportedType, "Copilot Chat drops events with unknown type %q", eventType)
+		}
 
-			err := emitDatas(dataFields, p.fn)
-			if err != nil && shouldLog(debug, LEVEL_DEBUG) {
-				return fmt.Errorf(red("\nAlas...Failed to process data fields:\n%v\n\nErrors: %v\n\n"), dataFields, err)
+	default:
+		// an empty event type dispatches a default message event per the SSE spec
+		if hasEventType {
+			message := "event field must have a type"
+			if p.mode == ParseModeStrict {
+				message = "Copilot Chat drops events with an empty type"
 			}
+			if !p.report(RuleEventMissingType, message) {
+				return
+			}
+		}
+
+		p.emitDatas(datas)
+	}
+}
+
+// joinData returns the payloads of an event, and whether they can be
+// emitted. The SSE spec joins the data lines of an event with newlines into a
+// single payload, while Copilot clients read every data line on its own.
+func (p *Parser) joinData(dataFields []string) ([]string, bool) {
+	if len(dataFields) <= 1 {
+		return dataFields, true
+	}
+
+	if p.mode == ParseModeStrict {
+		ok := p.report(RuleSSEMultilineData, "Copilot Chat parses every data line as a payload of its own, found an event with %d data lines", len(dataFields))
+		return dataFields, ok
+	}
+
+	joined := strings.Join(dataFields, "\n")
+	if json.Valid([]byte(joined)) {
+		ok := p.report(RuleSSEMultilineData, "event has %d data lines, which Copilot clients read on their own; send the payload on a single line", len(dataFields))
+		return []string{joined}, ok
+	}
+
+	// fall back to reading every line on its own, which is what the agent most
+	// likely meant when every line is a payload of its own
+	for _, d := range dataFields {
+		if d != "" && d != doneData && !json.Valid([]byte(d)) {
+			return []string{joined}, true
 		}
 	}
+	ok := p.report(RuleSSEMultilineData, "event has %d data lines, which the SSE spec joins into one payload; send every payload as its own event", len(dataFields))
+	return dataFields, ok
 }
 
-func (p *Parser) ValidEventCount() bool {
-	return p.eventCount > 1
+// Validate parses an SSE stream with the same rules as the chat and returns
+// every rule broken by it.
+func Validate(ctx context.Context, r io.Reader, mode ParseMode, rules *RuleSet) ([]Violation, error) {
+	p := NewParser(r, func(any) {})
+	p.SetMode(mode)
+	if rules != nil {
+		p.SetRules(rules)
+	}
+
+	if err := p.ParseAndEmit(ctx); err != nil {
+		return nil, err
+	}
+	return p.Violations(), nil
 }
 
-func emitErrors(data []string, fn dataEmitter) error {
+func (p *Parser) emitErrors(data []string) {
 	for _, d := range data {
 		var errs []CopilotError
 		if err := json.Unmarshal([]byte(d), &errs); err != nil {
-			return fmt.Errorf("ensure data is an array of copilot_errors")
+			p.report(RuleErrorInvalid, "ensure data is an array of copilot_errors")
+			continue
 		}
 
 		if len(errs) == 0 {
-			return fmt.Errorf("no errors found")
+			p.report(RuleErrorEmpty, "no errors found")
+			continue
 		}
 
-		var errMsg strings.Builder
+		valid := true
 		for i, err := range errs {
 			if err.Type == "" {
-				errMsg.WriteString(fmt.Sprintf("error %d is missing a type\n", i))
+				valid = p.report(RuleErrorMissingType, "error %d is missing a type", i) && valid
 			}
 			if err.Code == "" {
-				errMsg.WriteString(fmt.Sprintf("error %d is missing a code\n", i))
+				valid = p.report(RuleErrorMissingCode, "error %d is missing a code", i) && valid
 			}
 			if err.Message == "" {
-				errMsg.WriteString(fmt.Sprintf("error %d is missing a message\n", i))
+				valid = p.report(RuleErrorMissingMessage, "error %d is missing a message", i) && valid
 			}
 			if err.Identifier == "" {
-				errMsg.WriteString(fmt.Sprintf("error %d is missing an identifier\n", i))
+				valid = p.report(RuleErrorMissingIdentifier, "error %d is missing an identifier", i) && valid
 			}
-		}
 
-		if errMsg.Len() > 0 {
-			return fmt.Errorf(errMsg.String())
+			switch err.Type {
+			case "", ErrorTypeReference, ErrorTypeFunction, ErrorTypeAgent:
+			default:
+				valid = p.report(RuleErrorUnknownType, "error %d has an unknown type %q", i, err.Type) && valid
+			}
+			if err.Code != "" && !p.rules.knownErrorCode(err.Code) {
+				valid = p.report(RuleErrorUnknownCode, "error %d has a code %q that is not in the error code catalog", i, err.Code) && valid
+			}
+			if err.Identifier != "" {
+				if p.errorIDs[err.Identifier] {
+					valid = p.report(RuleErrorDuplicateID, "error %d reuses the identifier %q", i, err.Identifier) && valid
+				}
+				p.errorIDs[err.Identifier] = true
+			}
 		}
 
-		fn(errs)
+		if valid {
+			p.fn(errs)
+		}
 	}
-
-	return nil
 }
 
-func emitReferences(data []string, fn dataEmitter) error {
+func (p *Parser) emitReferences(data []string) {
 	for _, d := range data {
 		var refs []Reference
 		if err := json.Unmarshal([]byte(d), &refs); err != nil {
-			return fmt.Errorf("ensure data is an array of copilot_references")
+			p.report(RuleReferenceInvalid, "ensure data is an array of copilot_references")
+			continue
 		}
 
 		if len(refs) == 0 {
-			return fmt.Errorf("no references found")
+			p.report(RuleReferenceEmpty, "no references found")
+			continue
 		}
 
-		var errMsg strings.Builder
+		valid := true
 		for i, ref := range refs {
 			if ref.Type == "" {
-				errMsg.WriteString(fmt.Sprintf("ref %d is missing a type\n", i))
+				valid = p.report(RuleReferenceMissingType, "ref %d is missing a type", i) && valid
 			}
 			if ref.ID == "" {
-				errMsg.WriteString(fmt.Sprintf("ref %d is missing an id\n", i))
+				valid = p.report(RuleReferenceMissingID, "ref %d is missing an id", i) && valid
 			}
 			if ref.Metadata.DisplayName == "" {
-				errMsg.WriteString(fmt.Sprintf("ref %d is missing a metadata display name\n", i))
+				valid = p.report(RuleReferenceMissingDisplayName, "ref %d is missing a metadata display name", i) && valid
+			}
+			if ref.Metadata.DisplayURL != "" && !isAbsoluteURL(ref.Metadata.DisplayURL) {
+				valid = p.report(RuleReferenceInvalidDisplayURL, "ref %d has an invalid metadata display url %q", i, ref.Metadata.DisplayURL) && valid
+			}
+			if ref.Metadata.DisplayIcon != "" && !isDisplayIcon(ref.Metadata.DisplayIcon) {
+				valid = p.report(RuleReferenceInvalidDisplayIcon, "ref %d has an invalid metadata display icon %q", i, ref.Metadata.DisplayIcon) && valid
 			}
-		}
 
-		if errMsg.Len() > 0 {
-			return fmt.Errorf(errMsg.String())
+			if ref.Type == "" {
+				continue
+			}
+			schema, ok := p.rules.referenceSchema(ref.Type)
+			if !ok {
+				valid = p.report(RuleReferenceUnknownType, "ref %d has an unknown type %q", i, ref.Type) && valid
+				continue
+			}
+			// data is optional, references without it are only displayed
+			if ref.Data == nil {
+				continue
+			}
+			for _, problem := range schema.Validate("data", ref.Data) {
+				valid = p.report(RuleReferenceInvalidData, "ref %d of type %s: %s", i, ref.Type, problem) && valid
+			}
 		}
 
-		fn(refs)
+		if valid {
+			p.fn(refs)
+		}
 	}
-
-	return nil
 }
 
-func emitConfirmation(data []string, fn dataEmitter) error {
+func (p *Parser) emitConfirmation(data []string) {
 	for _, d := range data {
 		var confirmation Confirmation
 		if err := json.Unmarshal([]byte(d), &confirmation); err != nil {
-			return fmt.Errorf("ensure data is of type copilot_confirmation")
+			p.report(RuleConfirmationInvalid, "ensure data is of type copilot_confirmation")
+			continue
 		}
+		p.checkConfirmation()
 
-		var errMsg strings.Builder
+		valid := true
 		if confirmation.Type == "" {
-			errMsg.WriteString("confirmation is missing a type\n")
+			valid = p.report(RuleConfirmationMissingType, "confirmation is missing a type") && valid
 		}
 		if confirmation.Title == "" {
-			errMsg.WriteString("confirmation is missing a title\n")
+			valid = p.report(RuleConfirmationMissingTitle, "confirmation is missing a title") && valid
 		}
 		if confirmation.Message == "" {
-			errMsg.WriteString("confirmation is missing a message\n")
+			valid = p.report(RuleConfirmationMissingMessage, "confirmation is missing a message") && valid
 		}
 
-		if errMsg.Len() > 0 {
-			return fmt.Errorf(errMsg.String())
+		if valid {
+			p.fn(confirmation)
 		}
-
-		fn(confirmation)
 	}
-
-	return nil
 }
 
-func emitDatas(datas []string, fn dataEmitter) error {
+func (p *Parser) emitDatas(datas []string) {
 	for _, data := range datas {
-		if data == "" || data == "[DONE]" {
+		if data == doneData {
+			p.checkDone()
+			continue
+		}
+		if data == "" {
 			continue
 		}
 
+		valid := true
 		var message Message
 		if err := json.Unmarshal([]byte(data), &message); err == nil {
-			var errMsg strings.Builder
-
 			if message.Confirmation != nil {
-				errMsg.WriteString("setting confirmation in a message payload is not supported\n")
+				valid = p.report(RuleMessageConfirmationInPayload, "setting confirmation in a message payload is not supported") && valid
 			}
 
 			if message.Errors != nil {
-				errMsg.WriteString("setting errors in a message payload is not supported\n")
+				valid = p.report(RuleMessageErrorsInPayload, "setting errors in a message payload is not supported") && valid
 			}
 
 			if message.References != nil {
-				errMsg.WriteString("setting references in a message payload is not supported\n")
-			}
-
-			if errMsg.Len() > 0 {
-				return fmt.Errorf(errMsg.String())
+				valid = p.report(RuleMessageReferencesInPayload, "setting references in a message payload is not supported") && valid
 			}
 		}
+		if !valid {
+			continue
+		}
 
 		var chatMessage Completion
 		if err := json.Unmarshal([]byte(data), &chatMessage); err != nil {
-			return fmt.Errorf("failed to unmarshal response: %w", err)
+			p.report(RuleMessageInvalid, "failed to unmarshal response: %v", err)
+			continue
 		}
+		p.checkCompletion(chatMessage)
 
-		fn(chatMessage)
+		p.fn(chatMessage)
 	}
-
-	return nil
 }
 
 type messageBuffer []*Message
 
+// lastMessage returns the last message of the first choice, which is the one
+// Copilot clients display.
 func (mb *messageBuffer) lastMessage() *Message {
-	if len(*mb) == 0 {
-		*mb = append(*mb, new(Message))
-	}
+	return mb.lastMessageFor(0)
+}
 
+// lastMessageFor returns the last message of a choice, creating it when the
+// choice has none yet.
+func (mb *messageBuffer) lastMessageFor(index int) *Message {
 	buf := *mb
-	return buf[len(buf)-1]
+	for i := len(buf) - 1; i >= 0; i-- {
+		if buf[i].Choice() == index {
+			return buf[i]
+		}
+	}
+
+	m := new(Message)
+	if index != 0 {
+		m.metadata().Index = index
+	}
+	*mb = append(*mb, m)
+	return m
 }
 
 func (mb *messageBuffer) WriteConfirmation(c Confirmation) {
@@ -272,15 +515,24 @@ func (mb *messageBuffer) WriteErrors(e []CopilotError) {
 	}
 }
 
+// WriteChatMessage assembles the deltas of every choice of a chunk into the
+// messages of that choice.
 func (mb *messageBuffer) WriteChatMessage(m Completion) {
-	if len(m.Choices) > 0 {
-		choice := m.Choices[0]
-		lastmsg := mb.lastMessage()
+	// usage is usually sent in a last chunk without any choices
+	if m.Usage != nil && len(*mb) > 0 {
+		mb.lastMessage().metadata().Usage = m.Usage
+	}
+
+	for _, choice := range m.Choices {
+		lastmsg := mb.lastMessageFor(choice.Index)
 
-		// ensure that the last message in the buffer has the same role as the choice
+		// ensure that the last message of the choice has the same role as the delta
 		// this will help us group delta messages by role
 		if lastmsg.Role != "" && lastmsg.Role != choice.Delta.Role && choice.Delta.Role != "" {
 			lastmsg = &Message{Role: choice.Delta.Role}
+			if choice.Index != 0 {
+				lastmsg.metadata().Index = choice.Index
+			}
 			*mb = append(*mb, lastmsg)
 		}
 
@@ -291,5 +543,73 @@ func (mb *messageBuffer) WriteChatMessage(m Completion) {
 
 		lastmsg.Content += choice.Delta.Content
 		lastmsg.FunctionCall = choice.Delta.FunctionCall
+		lastmsg.ToolCalls = mergeToolCalls(lastmsg.ToolCalls, choice.Delta.ToolCalls)
+		lastmsg.recordChunk(m, choice)
+	}
+}
+
+// Choice returns the index of the completion choice the message belongs to.
+func (m *Message) Choice() int {
+	if m.Metadata == nil {
+		return 0
+	}
+	return m.Metadata.Index
+}
+
+// metadata returns the metadata of the message, creating it when needed.
+func (m *Message) metadata() *MessageMetadata {
+	if m.Metadata == nil {
+		m.Metadata = new(MessageMetadata)
+	}
+	return m.Metadata
+}
+
+// recordChunk aggregates the metadata of a chunk of the message.
+func (m *Message) recordChunk(c Completion, choice CompletionChoice) {
+	md := m.metadata()
+	md.Index = choice.Index
+	md.Chunks++
+	if md.ID == "" {
+		md.ID = c.ID
+	}
+	if md.Model == "" {
+		md.Model = c.Model
+	}
+	if md.Created == 0 {
+		md.Created = c.Created
+	}
+	if md.SystemFingerprint == "" {
+		md.SystemFingerprint = c.SystemFingerprint
+	}
+	if choice.FinishReason != "" {
+		md.FinishReason = choice.FinishReason
+	}
+	if c.Usage != nil {
+		md.Usage = c.Usage
+	}
+}
+
+// mergeToolCalls appends streamed tool call deltas to the tool calls with the
+// same index, the arguments of a tool call being streamed in chunks.
+func mergeToolCalls(calls []ToolCall, deltas []ToolCall) []ToolCall {
+	for _, delta := range deltas {
+		i := 0
+		for i < len(calls) && calls[i].Index != delta.Index {
+			i++
+		}
+		if i == len(calls) {
+			calls = append(calls, delta)
+			continue
+		}
+
+		if delta.ID != "" {
+			calls[i].ID = delta.ID
+		}
+		if delta.Type != "" {
+			calls[i].Type = delta.Type
+		}
+		calls[i].Function.Name += delta.Function.Name
+		calls[i].Function.Arguments += delta.Function.Arguments
 	}
+	return calls
 }
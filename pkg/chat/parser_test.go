@@ -7,18 +7,66 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseAndEmit(t *testing.T) {
 	testCases := []struct {
-		name          string
-		stream        string
-		expectedAny   []any
-		expectedTypes []interface{}
-		expectedError error
+		name               string
+		stream             string
+		mode               ParseMode
+		expectedAny        []any
+		expectedTypes      []interface{}
+		expectedViolations []string
 	}{
 		{
 			name: "happy_path",
+			stream: `event: copilot_references
+data: [{"type": "github.repository", "id": "1", "data": {"name": "gh-debug-cli", "ownerLogin": "octocat"}, "metadata": {"display_name": "octocat/gh-debug-cli"}}]
+
+data: {"choices":[{"delta":{"role":"assistant","content":"ahoy "}}]}
+
+data: {"choices":[{"delta":{"content":"there"}}]}
+
+				`,
+			expectedTypes: []interface{}{
+				[]Reference{},
+				Completion{},
+				Completion{},
+			},
+			expectedAny: []any{
+				[]Reference{
+					{
+						Type: "github.repository",
+						ID:   "1",
+						Metadata: ReferenceMetadata{
+							DisplayName: "octocat/gh-debug-cli",
+						},
+					},
+				},
+				Completion{
+					Choices: []CompletionChoice{
+						{
+							Delta: Message{
+								Role:    "assistant",
+								Content: "ahoy ",
+							},
+						},
+					},
+				},
+				Completion{
+					Choices: []CompletionChoice{
+						{
+							Delta: Message{
+								Content: "there",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "failure_multiple_event_types",
 			stream: `event: copilot_confirmation
 data: {"type": "confirm", "title": "Test Confirmation", "message": "This is a test confirmation"}
 
@@ -70,10 +118,14 @@ data: {"choices":[{"delta":{"content":"ahoy there"}}]}
 					},
 				},
 			},
-			expectedError: nil,
+			expectedViolations: []string{
+				"[warning] reference.unknown-type: ref 0 has an unknown type \"ref\"",
+				"[warning] error.unknown-type: error 0 has an unknown type \"error\"",
+				"[error] event.multiple-types: cannot have more than one event type in an invocation, found 3: copilot_confirmation, copilot_errors, copilot_references",
+			},
 		},
 		{
-			name: "happy_path_arrays",
+			name: "failure_multiple_event_types_arrays",
 			stream: `event: copilot_confirmation
 data: {"type": "confirm", "title": "Test Confirmation", "message": "This is a test confirmation"}
 
@@ -138,7 +190,13 @@ data: {"choices":[{"delta":{"content":"ahoy there"}}]}
 					},
 				},
 			},
-			expectedError: nil,
+			expectedViolations: []string{
+				"[warning] reference.unknown-type: ref 0 has an unknown type \"ref\"",
+				"[warning] reference.unknown-type: ref 1 has an unknown type \"ref\"",
+				"[warning] error.unknown-type: error 0 has an unknown type \"error\"",
+				"[warning] error.unknown-type: error 1 has an unknown type \"error\"",
+				"[error] event.multiple-types: cannot have more than one event type in an invocation, found 3: copilot_confirmation, copilot_errors, copilot_references",
+			},
 		},
 		{
 			name: "failure_mismatched_event_types",
@@ -146,14 +204,19 @@ data: {"choices":[{"delta":{"content":"ahoy there"}}]}
 data: {"type": "confirm", "title": "Test Confirmation", "message": "This is a test confirmation"}
 
 		`,
-			expectedError: fmt.Errorf("\x1b[31m\nAlas...The following is not a valid copilot reference:\n[{\"type\": \"confirm\", \"title\": \"Test Confirmation\", \"message\": \"This is a test confirmation\"}]\n\nErrors:\nensure data is an array of copilot_references\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] reference.invalid: ensure data is an array of copilot_references",
+			},
 		},
 		{
 			name: "failure_invalid_event_type",
+			mode: ParseModeStrict,
 			stream: `retry: copilot_references
 
 		`,
-			expectedError: fmt.Errorf("\x1b[31monly 'event' and 'data' fields are supported, found: retry\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] sse.unsupported-field: Copilot Chat ignores the \"retry\" field, it only reads `event` and `data`",
+			},
 		},
 		{
 			name: "failure_missing_copilot_reference_metadata",
@@ -161,15 +224,22 @@ data: {"type": "confirm", "title": "Test Confirmation", "message": "This is a te
 data: [{"type": "", "id": "", "metadata": {"display_name": ""}}]
 
 				`,
-			expectedError: fmt.Errorf("\x1b[31m\nAlas...The following is not a valid copilot reference:\n[[{\"type\": \"\", \"id\": \"\", \"metadata\": {\"display_name\": \"\"}}]]\n\nErrors:\nref 0 is missing a type\nref 0 is missing an id\nref 0 is missing a metadata display name\n\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] reference.missing-type: ref 0 is missing a type",
+				"[error] reference.missing-id: ref 0 is missing an id",
+				"[error] reference.missing-display-name: ref 0 is missing a metadata display name",
+			},
 		},
 		{
 			name: "failure_missing_data_field",
+			mode: ParseModeStrict,
 			stream: `event: copilot_references
 [{"type": "", "id": "", "metadata": {"display_name": ""}}]
 
 				`,
-			expectedError: fmt.Errorf("\x1b[31monly 'event' and 'data' fields are supported, found: [{\"type\"\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] sse.unsupported-field: Copilot Chat ignores the \"[{\\\"type\\\"\" field, it only reads `event` and `data`",
+			},
 		},
 		{
 			name: "failure_references_not_array",
@@ -177,22 +247,29 @@ data: [{"type": "", "id": "", "metadata": {"display_name": ""}}]
 data: {"type": "ref", "id": "1", "metadata": {"display_name": "Test Reference"}}
 
 				`,
-			expectedError: fmt.Errorf("\x1b[31m\nAlas...The following is not a valid copilot reference:\n[{\"type\": \"ref\", \"id\": \"1\", \"metadata\": {\"display_name\": \"Test Reference\"}}]\n\nErrors:\nensure data is an array of copilot_references\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] reference.invalid: ensure data is an array of copilot_references",
+			},
 		},
 		{
 			name: "failure_invalid_message_chunk",
 			stream: `data: {"copilot_confirmation": {"type":"action","title":"Turn off feature flag","message":"Are you sure you wish to turn off the feature flag?","confirmation":{"id":"id-123"}}}
 
 				`,
-			expectedError: fmt.Errorf("\x1b[31m\nAlas...Failed to process data fields:\n[{\"copilot_confirmation\": {\"type\":\"action\",\"title\":\"Turn off feature flag\",\"message\":\"Are you sure you wish to turn off the feature flag?\",\"confirmation\":{\"id\":\"id-123\"}}}]\n\nErrors: setting confirmation in a message payload is not supported\n\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] message.confirmation-in-payload: setting confirmation in a message payload is not supported",
+			},
 		},
 		{
 			name: "failure_invalid_error_type",
+			mode: ParseModeStrict,
 			stream: `event: error
 data: {"type":"function","code":"foo","message":"A function error occurred","identifier":"fn123"}
 
 		`,
-			expectedError: fmt.Errorf("\x1b[31m\nAlas...The following is not a valid event:\n[{\"type\":\"function\",\"code\":\"foo\",\"message\":\"A function error occurred\",\"identifier\":\"fn123\"}]\n\nErrors:\ntype not supported: error\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] event.unsupported-type: Copilot Chat drops events with unknown type \"error\"",
+			},
 		},
 		{
 			name: "failure_invalid_error_must_be_array",
@@ -200,17 +277,112 @@ data: {"type":"function","code":"foo","message":"A function error occurred","ide
 data: {"type":"function","code":"foo","message":"A function error occurred","identifier":"fn123"}
 
 		`,
-			expectedError: fmt.Errorf("\x1b[31m\nAlas...The following is not a valid a copilot error:\n[{\"type\":\"function\",\"code\":\"foo\",\"message\":\"A function error occurred\",\"identifier\":\"fn123\"}]\n\nErrors:\nensure data is an array of copilot_errors\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] error.invalid: ensure data is an array of copilot_errors",
+			},
 		},
 		{
 			name: "failure_extra_double_quotes",
+			mode: ParseModeStrict,
 			stream: `event: copilot_errors
 data: [{"type":"reference","code":"foo","message":"A reference error occurred","identifier":"ref123"},{"type":"function","code":"foo","message":"A function error occurred","identifier":"fn123"},{"type":"agent","code":"foo","message":"An agent error occurred","identifier":"agt123"}]
 
 "data: [DONE]"
 
 		`,
-			expectedError: fmt.Errorf("\x1b[31monly 'event' and 'data' fields are supported, found: \"data\n\n\x1b[37m"),
+			expectedViolations: []string{
+				"[error] sse.unsupported-field: Copilot Chat ignores the \"\\\"data\" field, it only reads `event` and `data`",
+			},
+		},
+		{
+			name: "lenient_id_and_retry",
+			stream: `id: 1
+retry: 1000
+data: {"choices":[{"delta":{"content":"ahoy there"}}]}
+
+`,
+			expectedTypes: []interface{}{Completion{}},
+			expectedAny: []any{
+				Completion{Choices: []CompletionChoice{{Delta: Message{Content: "ahoy there"}}}},
+			},
+		},
+		{
+			name: "lenient_comment_keepalive",
+			stream: `: keepalive
+
+data: {"choices":[{"delta":{"content":"ahoy there"}}]}
+
+`,
+			expectedTypes: []interface{}{Completion{}},
+			expectedAny: []any{
+				Completion{Choices: []CompletionChoice{{Delta: Message{Content: "ahoy there"}}}},
+			},
+		},
+		{
+			name: "lenient_multiline_data_joined",
+			stream: `event: copilot_references
+data: [{"type": "ref", "id": "1",
+data:   "metadata": {"display_name": "Test Reference"}}]
+
+`,
+			expectedTypes: []interface{}{[]Reference{}},
+			expectedAny: []any{
+				[]Reference{{Type: "ref", ID: "1", Metadata: ReferenceMetadata{DisplayName: "Test Reference"}}},
+			},
+			expectedViolations: []string{
+				"[warning] sse.multiline-data: event has 2 data lines, which Copilot clients read on their own; send the payload on a single line",
+				"[warning] reference.unknown-type: ref 0 has an unknown type \"ref\"",
+			},
+		},
+		{
+			name: "lenient_multiline_data_per_line",
+			stream: `data: {"choices":[{"delta":{"content":"ahoy "}}]}
+data: {"choices":[{"delta":{"content":"there"}}]}
+
+`,
+			expectedTypes: []interface{}{Completion{}, Completion{}},
+			expectedAny: []any{
+				Completion{Choices: []CompletionChoice{{Delta: Message{Content: "ahoy "}}}},
+				Completion{Choices: []CompletionChoice{{Delta: Message{Content: "there"}}}},
+			},
+			expectedViolations: []string{
+				"[warning] sse.multiline-data: event has 2 data lines, which the SSE spec joins into one payload; send every payload as its own event",
+			},
+		},
+		{
+			name: "lenient_unknown_fields_and_events",
+			stream: `event: ping
+data: {}
+
+"data: [DONE]"
+
+`,
+			expectedViolations: []string{
+				"[warning] event.unsupported-type: ignored unsupported event type \"ping\"",
+				"[warning] sse.unsupported-field: ignored unknown field \"\\\"data\"",
+			},
+		},
+		{
+			name: "failure_strict_empty_event_type",
+			mode: ParseModeStrict,
+			stream: `event:
+data: {"choices":[{"delta":{"content":"ahoy"}}]}
+
+`,
+			expectedViolations: []string{
+				"[error] event.missing-type: Copilot Chat drops events with an empty type",
+			},
+		},
+		{
+			name: "failure_strict_multiline_data",
+			mode: ParseModeStrict,
+			stream: `data: {"choices":[{"delta":{"content":"ahoy "}}]}
+data: {"choices":[{"delta":{"content":"there"}}]}
+
+`,
+			expectedViolations: []string{
+				"[error] sse.multiline-data: Copilot Chat parses every data line as a payload of its own, found an event with 2 data lines",
+			},
 		},
 	}
 
@@ -222,9 +394,25 @@ data: [{"type":"reference","code":"foo","message":"A reference error occurred","
 			}
 
 			p := NewParser(bytes.NewBufferString(tc.stream), dataEmitter)
-			err := p.ParseAndEmit(context.Background(), LEVEL_DEBUG)
+			if tc.mode != "" {
+				p.SetMode(tc.mode)
+			}
 
-			assert.Equal(t, tc.expectedError, err)
+			// the streams are fragments of a response, the structure of whole
+			// responses is covered by TestValidate
+			rules := NewRuleSet()
+			for _, id := range []string{RuleStreamMissingDone, RuleMessageMissingFinishReason, RuleConfirmationBeforeText} {
+				require.NoError(t, rules.Set(id, SeverityOff))
+			}
+			p.SetRules(rules)
+			err := p.ParseAndEmit(context.Background())
+			assert.NoError(t, err)
+
+			var actualViolations []string
+			for _, v := range p.Violations() {
+				actualViolations = append(actualViolations, v.String())
+			}
+			assert.Equal(t, tc.expectedViolations, actualViolations)
 
 			if tc.expectedAny != nil {
 				if emittedData != nil {
@@ -296,3 +484,207 @@ data: [{"type":"reference","code":"foo","message":"A reference error occurred","
 	}
 
 }
+
+func TestParser_OnEvent(t *testing.T) {
+	stream := "event: copilot_confirmation\ndata: {\"type\": \"confirm\", \"title\": \"Title\", \"message\": \"Message\"}\n\ndata: {\"choices\":[]}\n\ndata: [DONE]\n\n"
+
+	var raws []string
+	parser := NewParser(bytes.NewBufferString(stream), func(any) {})
+	parser.OnEvent(func(raw []byte) {
+		raws = append(raws, string(raw))
+	})
+	assert.NoError(t, parser.ParseAndEmit(context.Background()))
+
+	assert.Equal(t, []string{
+		"event: copilot_confirmation\ndata: {\"type\": \"confirm\", \"title\": \"Title\", \"message\": \"Message\"}\n",
+		"data: {\"choices\":[]}\n",
+		"data: [DONE]\n",
+	}, raws)
+}
+
+func TestParser_StrictMultilineData(t *testing.T) {
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy \"}}]}\ndata: {\"choices\":[{\"delta\":{\"content\":\"there\"}}]}\n\n"
+
+	for _, severity := range []Severity{SeverityOff, SeverityInfo} {
+		t.Run(string(severity), func(t *testing.T) {
+			var emitted []any
+			p := NewParser(bytes.NewBufferString(stream), func(data any) { emitted = append(emitted, data) })
+			p.SetMode(ParseModeStrict)
+			rules := NewRuleSet()
+			require.NoError(t, rules.Set(RuleSSEMultilineData, severity))
+			p.SetRules(rules)
+
+			require.NoError(t, p.ParseAndEmit(context.Background()))
+			// unless the rule fails the event, every data line is read on its own
+			// as Copilot Chat does
+			assert.Len(t, emitted, 2)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name               string
+		stream             string
+		rules              map[string]Severity
+		referenceTypes     map[string]*Schema
+		errorCodes         []string
+		expectedViolations []Violation
+	}{
+		{
+			name:   "happy_path",
+			stream: "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy there\"}}]}\n\ndata: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name: "failure_multiple_event_types",
+			stream: `event: copilot_confirmation
+data: {"type": "confirm", "title": "Test Confirmation", "message": "This is a test confirmation"}
+
+event: copilot_references
+data: [{"type": "ref", "id": "1", "metadata": {"display_name": "Test Reference"}}]
+
+`,
+			expectedViolations: []Violation{
+				{Rule: RuleConfirmationBeforeText, Severity: SeverityWarning, Message: "confirmation sent before any message content", Event: 1},
+				{Rule: RuleReferenceUnknownType, Severity: SeverityWarning, Message: `ref 0 has an unknown type "ref"`, Event: 2, Offset: 127},
+				{Rule: RuleEventMultipleTypes, Severity: SeverityError, Message: "cannot have more than one event type in an invocation, found 2: copilot_confirmation, copilot_references"},
+				{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "the response did not end with data: [DONE]"},
+			},
+		},
+		{
+			name: "rule_overrides",
+			stream: `event: copilot_confirmation
+data: {"type": "confirm", "title": "Test Confirmation", "message": "This is a test confirmation"}
+
+event: copilot_references
+data: [{"type": "ref", "id": "1", "metadata": {}}]
+
+`,
+			rules: map[string]Severity{
+				RuleEventMultipleTypes:          SeverityWarning,
+				RuleReferenceMissingDisplayName: SeverityOff,
+			},
+			expectedViolations: []Violation{
+				{Rule: RuleConfirmationBeforeText, Severity: SeverityWarning, Message: "confirmation sent before any message content", Event: 1},
+				{Rule: RuleReferenceUnknownType, Severity: SeverityWarning, Message: `ref 0 has an unknown type "ref"`, Event: 2, Offset: 127},
+				{Rule: RuleEventMultipleTypes, Severity: SeverityWarning, Message: "cannot have more than one event type in an invocation, found 2: copilot_confirmation, copilot_references"},
+				{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "the response did not end with data: [DONE]"},
+			},
+		},
+		{
+			name: "keeps_going_after_invalid_events",
+			stream: `event: copilot_references
+data: [{"type": "ref", "id": "1", "metadata": {}}]
+
+data: {"choices":[{"delta":{"content":"ahoy there"}}]}
+
+event: copilot_references
+data: [{"type": "ref", "metadata": {"display_name": "Test Reference"}}]
+
+`,
+			expectedViolations: []Violation{
+				{Rule: RuleReferenceMissingDisplayName, Severity: SeverityError, Message: "ref 0 is missing a metadata display name", Event: 1},
+				{Rule: RuleReferenceUnknownType, Severity: SeverityWarning, Message: `ref 0 has an unknown type "ref"`, Event: 1, Offset: 0},
+				{Rule: RuleReferenceMissingID, Severity: SeverityError, Message: "ref 0 is missing an id", Event: 3, Offset: 134},
+				{Rule: RuleReferenceUnknownType, Severity: SeverityWarning, Message: `ref 0 has an unknown type "ref"`, Event: 3, Offset: 134},
+				{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "the response did not end with data: [DONE]"},
+				{Rule: RuleMessageMissingFinishReason, Severity: SeverityWarning, Message: "choice 0 never set a finish_reason"},
+			},
+		},
+		{
+			name: "reference_types",
+			stream: `event: copilot_references
+data: [{"type": "github.repository", "id": "1", "data": {"name": "gh-debug-cli", "ownerLogin": "octocat"}, "metadata": {"display_name": "octocat/gh-debug-cli", "display_url": "https://github.com/octocat/gh-debug-cli"}}, {"type": "client.selection", "id": "2", "data": {"content": 42}, "metadata": {"display_name": "main.go", "display_url": "main.go", "display_icon": "anchor"}}, {"type": "acme.ticket", "id": "3", "data": {"key": 42}, "metadata": {"display_name": "ACME-42"}}, {"type": "acme.parrot", "id": "4", "metadata": {"display_name": "Polly"}}]
+
+`,
+			referenceTypes: map[string]*Schema{
+				"acme.ticket": {Type: "object", Required: []string{"key"}, Properties: map[string]*Schema{"key": {Type: "string"}}},
+			},
+			expectedViolations: []Violation{
+				{Rule: RuleReferenceInvalidDisplayURL, Severity: SeverityWarning, Message: `ref 1 has an invalid metadata display url "main.go"`, Event: 1},
+				{Rule: RuleReferenceInvalidDisplayIcon, Severity: SeverityWarning, Message: `ref 1 has an invalid metadata display icon "anchor"`, Event: 1},
+				{Rule: RuleReferenceInvalidData, Severity: SeverityWarning, Message: `ref 1 of type client.selection: data.content: expected string, found number`, Event: 1},
+				{Rule: RuleReferenceInvalidData, Severity: SeverityWarning, Message: `ref 2 of type acme.ticket: data.key: expected string, found number`, Event: 1},
+				{Rule: RuleReferenceUnknownType, Severity: SeverityWarning, Message: `ref 3 has an unknown type "acme.parrot"`, Event: 1},
+				{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "the response did not end with data: [DONE]"},
+			},
+		},
+		{
+			name: "error_semantics",
+			stream: `event: copilot_errors
+data: [{"type": "reference", "code": "not_found", "message": "A reference error occurred", "identifier": "ref123"}, {"type": "tool", "code": "timeout", "message": "A tool error occurred", "identifier": "fn123"}]
+
+event: copilot_errors
+data: [{"type": "agent", "code": "teapot", "message": "An agent error occurred", "identifier": "ref123"}]
+
+`,
+			errorCodes: []string{"not_found", "timeout"},
+			expectedViolations: []Violation{
+				{Rule: RuleErrorUnknownType, Severity: SeverityWarning, Message: `error 1 has an unknown type "tool"`, Event: 1},
+				{Rule: RuleErrorUnknownCode, Severity: SeverityWarning, Message: `error 0 has a code "teapot" that is not in the error code catalog`, Event: 2, Offset: 235},
+				{Rule: RuleErrorDuplicateID, Severity: SeverityWarning, Message: `error 0 reuses the identifier "ref123"`, Event: 2, Offset: 235},
+				{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "the response did not end with data: [DONE]"},
+			},
+		},
+		{
+			name:   "empty_stream",
+			stream: "",
+			expectedViolations: []Violation{
+				{Rule: RuleStreamEmpty, Severity: SeverityWarning, Message: "the response has no events"},
+			},
+		},
+		{
+			name: "stream_structure",
+			stream: `data: {"id":"chatcmpl-1","model":"gpt-4o","created":1700000000,"choices":[{"index":0,"delta":{"role":"assistant","content":"ahoy"}}]}
+
+data: {"id":"chatcmpl-2","model":"gpt-4o","created":1700000000,"choices":[{"index":0,"delta":{"role":"user","content":" matey"}}]}
+
+data: {"id":"chatcmpl-3","model":"gpt-4o","created":1700000000,"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+data: {"choices":[{"index":0,"delta":{"content":"too late"}}]}
+
+data: [DONE]
+
+`,
+			expectedViolations: []Violation{
+				{Rule: RuleMessageInconsistentMetadata, Severity: SeverityWarning, Message: "chunks have different id values: chatcmpl-1 and chatcmpl-2", Event: 2, Offset: 135},
+				{Rule: RuleMessageRoleChange, Severity: SeverityWarning, Message: "choice 0 changed role from assistant to user before finishing its message", Event: 2, Offset: 135},
+				{Rule: RuleStreamDataAfterDone, Severity: SeverityWarning, Message: `found data after [DONE]: {"choices":[{"index":0,"delta":{"content":"too late"}}]}`, Event: 5, Offset: 404},
+				{Rule: RuleStreamDuplicateDone, Severity: SeverityWarning, Message: "found [DONE] 2 times", Event: 6, Offset: 468},
+				{Rule: RuleMessageMissingFinishReason, Severity: SeverityWarning, Message: "choice 0 never set a finish_reason"},
+			},
+		},
+		{
+			name: "multiple_choices",
+			stream: `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"ahoy"}},{"index":1,"delta":{"role":"assistant","content":"avast"}}]}
+
+data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"},{"index":1,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`,
+			expectedViolations: []Violation{
+				{Rule: RuleMessageMultipleChoices, Severity: SeverityWarning, Message: "found choice 1, Copilot clients only display choice 0", Event: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := NewRuleSet()
+			for id, severity := range tc.rules {
+				require.NoError(t, rules.Set(id, severity))
+			}
+			for referenceType, schema := range tc.referenceTypes {
+				rules.RegisterReferenceType(referenceType, schema)
+			}
+			rules.RegisterErrorCodes(tc.errorCodes...)
+
+			violations, err := Validate(context.Background(), bytes.NewBufferString(tc.stream), ParseModeStrict, rules)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedViolations, violations)
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alexeyco/simpletable"
+)
+
+// PrettyRenderer renders turns for a terminal, with colors, and tables of
+// the parsed data in DEBUG mode.
+type PrettyRenderer struct {
+	LogLevel string
+
+	// Markdown renders the content of messages as markdown, and CheckMarkdown
+	// flags the markdown Copilot Chat does not render.
+	Markdown      bool
+	CheckMarkdown bool
+
+	// Colors colors the output. The zero Colors leaves it plain.
+	Colors Colors
+}
+
+func (r *PrettyRenderer) Prompt(w io.Writer, username string) error {
+	_, err := fmt.Fprintf(w, "%s: ", r.Colors.userColor(username))
+	return err
+}
+
+func (r *PrettyRenderer) Notice(w io.Writer, notice Notice) error {
+	var err error
+	switch notice.Level {
+	case NoticeBanner:
+		_, err = fmt.Fprintf(w, "\n%s\n", notice.Text)
+	case NoticeError:
+		_, err = io.WriteString(w, r.Colors.errorColor(fmt.Sprintf("Alas...%s\n", notice.Text)))
+	default:
+		_, err = io.WriteString(w, r.Colors.infoColor(notice.Text+"\n"))
+	}
+	return err
+}
+
+func (r *PrettyRenderer) Turn(w io.Writer, turn Turn) error {
+	var msg strings.Builder
+
+	var httpErr *HTTPError
+	var interruptedErr *InterruptedError
+	switch {
+	case errors.As(turn.Err, &httpErr):
+		msg.WriteString(r.Colors.errorColor(httpErr.Details()))
+	case errors.As(turn.Err, &interruptedErr):
+		msg.WriteString(r.Colors.errorColor(interruptedErr.Details()))
+	case turn.Err != nil:
+		msg.WriteString(r.Colors.errorColor(fmt.Sprintf("Alas...%s\n", turn.Err)))
+	}
+
+	if resp := turn.Response; resp != nil {
+		// every choice is shown as an alternative
+		choices := responseChoices(resp)
+		for _, choice := range choices {
+			if len(choices) > 1 {
+				msg.WriteString(r.Colors.warningColor(fmt.Sprintf("\n--- Choice %d ---\n", choice)))
+			}
+			for _, m := range resp.Messages {
+				if m.Choice() == choice {
+					msg.WriteString(r.message(m))
+				}
+			}
+		}
+		if len(choices) > 1 {
+			msg.WriteString(r.Colors.warningColor(fmt.Sprintf("\nThe agent sent %d choices, and Copilot only shows the first one. Type `%s N` to keep choice N in the history instead.\n", len(choices), choiceCommand)))
+		}
+
+		msg.WriteString(violationsOutput(resp.Violations, r.Colors))
+
+		if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+			msg.WriteString(r.Colors.debugColor(resp.Metrics.String()))
+		}
+	}
+
+	_, err := io.WriteString(w, msg.String())
+	return err
+}
+
+// violationsOutput summarizes the rules broken by a response, colored by
+// severity, along with where in the stream each was broken.
+func violationsOutput(violations []Violation, c Colors) string {
+	if len(violations) == 0 {
+		return ""
+	}
+
+	counts := map[Severity]int{}
+	for _, v := range violations {
+		counts[v.Severity]++
+	}
+	var summary []string
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		if counts[severity] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[severity], severity))
+		}
+	}
+
+	var msg strings.Builder
+	msg.WriteString(c.errorColor(fmt.Sprintf("\nAlas...The response broke agent protocol rules %d times (%s):\n", len(violations), strings.Join(summary, ", "))))
+	for _, v := range violations {
+		line := fmt.Sprintf("%s (%s)", v, v.Location())
+		switch v.Severity {
+		case SeverityError:
+			msg.WriteString(c.errorColor(line))
+		case SeverityWarning:
+			msg.WriteString(c.warningColor(line))
+		default:
+			msg.WriteString(line)
+		}
+		msg.WriteString("\n")
+	}
+	msg.WriteString("\n")
+	return msg.String()
+}
+
+// message renders a single message of a response.
+func (r *PrettyRenderer) message(m *Message) string {
+
+	var msg strings.Builder
+	if m.FunctionCall != nil {
+		if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+			msg.WriteString(r.Colors.debugColor("\nHuzzah! You successfully received a function call!\n"))
+
+			table := simpletable.New()
+			table.Header = &simpletable.Header{
+				Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignCenter, Text: "Key"},
+					{Align: simpletable.AlignCenter, Text: "Value"},
+				},
+			}
+			cells := [][]*simpletable.Cell{
+				{{Text: "role"}, {Text: m.Role}},
+				{{Text: "name"}, {Text: m.FunctionCall.Name}},
+				{{Text: "arguments"}, {Text: m.FunctionCall.Arguments}},
+			}
+			table.Body = &simpletable.Body{Cells: cells}
+
+			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+				{Align: simpletable.AlignCenter, Span: 2, Text: "Parsed function data"},
+			}}
+
+			table.SetStyle(simpletable.StyleUnicode)
+			msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+		}
+
+	} else {
+		if m.Role != "" && m.Content != "" {
+			content := m.Content
+			if r.Markdown {
+				content = RenderMarkdown(content, r.Colors)
+			}
+			msg.WriteString(fmt.Sprintf("%s: %s\n", r.Colors.roleColor(m.Role), content))
+			if r.CheckMarkdown {
+				msg.WriteString(markdownIssuesOutput(UnsupportedMarkdown(m.Content), r.Colors))
+			}
+
+			if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+				msg.WriteString(fmt.Sprintf("\n%s\n", r.Colors.debugColor("Huzzah! You successfully received a message!")))
+
+				table := simpletable.New()
+				table.Header = &simpletable.Header{
+					Cells: []*simpletable.Cell{
+						{Align: simpletable.AlignCenter, Text: "Role"},
+						{Align: simpletable.AlignCenter, Text: "Content"},
+					},
+				}
+				cells := [][]*simpletable.Cell{
+					{{Text: m.Role}, {Text: fmt.Sprintf("[condensed] %.50s", m.Content)}},
+				}
+				table.Body = &simpletable.Body{Cells: cells}
+
+				table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignRight, Span: 2, Text: "Parsed message data"},
+				}}
+
+				table.SetStyle(simpletable.StyleUnicode)
+				msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+			}
+		}
+	}
+
+	if len(m.ToolCalls) > 0 && shouldLog(r.LogLevel, LEVEL_DEBUG) {
+		for _, call := range m.ToolCalls {
+			msg.WriteString(r.Colors.debugColor("\nHuzzah! You successfully received a tool call!\n"))
+
+			table := simpletable.New()
+			table.Header = &simpletable.Header{
+				Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignCenter, Text: "Key"},
+					{Align: simpletable.AlignCenter, Text: "Value"},
+				},
+			}
+			cells := [][]*simpletable.Cell{
+				{{Text: "role"}, {Text: m.Role}},
+				{{Text: "id"}, {Text: call.ID}},
+				{{Text: "type"}, {Text: call.Type}},
+				{{Text: "name"}, {Text: call.Function.Name}},
+				{{Text: "arguments"}, {Text: call.Function.Arguments}},
+			}
+			table.Body = &simpletable.Body{Cells: cells}
+
+			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+				{Align: simpletable.AlignCenter, Span: 2, Text: "Parsed tool call data"},
+			}}
+
+			table.SetStyle(simpletable.StyleUnicode)
+			msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+		}
+	}
+
+	if md := m.Metadata; md != nil {
+		if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+			table := simpletable.New()
+			table.Header = &simpletable.Header{
+				Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignLeft, Text: "Key"},
+					{Align: simpletable.AlignLeft, Text: "Value"},
+				},
+			}
+
+			cells := [][]*simpletable.Cell{
+				{{Text: "index"}, {Text: fmt.Sprintf("%d", md.Index)}},
+				{{Text: "id"}, {Text: md.ID}},
+				{{Text: "model"}, {Text: md.Model}},
+				{{Text: "created"}, {Text: formatCreated(md.Created)}},
+				{{Text: "system_fingerprint"}, {Text: md.SystemFingerprint}},
+				{{Text: "finish_reason"}, {Text: md.FinishReason}},
+				{{Text: "chunks"}, {Text: fmt.Sprintf("%d", md.Chunks)}},
+			}
+			if md.Usage != nil {
+				cells = append(cells,
+					[]*simpletable.Cell{{Text: "prompt_tokens"}, {Text: fmt.Sprintf("%d", md.Usage.PromptTokens)}},
+					[]*simpletable.Cell{{Text: "completion_tokens"}, {Text: fmt.Sprintf("%d", md.Usage.CompletionTokens)}},
+					[]*simpletable.Cell{{Text: "total_tokens"}, {Text: fmt.Sprintf("%d", md.Usage.TotalTokens)}},
+				)
+			}
+			table.Body = &simpletable.Body{Cells: cells}
+
+			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+				{Align: simpletable.AlignRight, Span: 2, Text: "Parsed message metadata"},
+			}}
+
+			table.SetStyle(simpletable.StyleUnicode)
+			msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+		}
+
+		switch md.FinishReason {
+		case "length":
+			msg.WriteString(r.Colors.warningColor("The message was cut short because it reached the maximum length (finish_reason: length)\n"))
+		case "content_filter":
+			msg.WriteString(r.Colors.warningColor("The message was cut short by content filtering (finish_reason: content_filter)\n"))
+		}
+	}
+
+	if m.Confirmation != nil {
+		if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+			msg.WriteString(r.Colors.debugColor("\nHuzzah! You successfully received a confirmation!\n"))
+
+			table := simpletable.New()
+			table.Header = &simpletable.Header{
+				Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignLeft, Text: "Key"},
+					{Align: simpletable.AlignLeft, Text: "Value"},
+				},
+			}
+
+			cells := [][]*simpletable.Cell{
+				{{Text: "type"}, {Text: m.Confirmation.Type}},
+				{{Text: "title"}, {Text: m.Confirmation.Title}},
+				{{Text: "message"}, {Text: m.Confirmation.Message}},
+				{{Text: "confirmation"}, {Text: fmt.Sprintf("%s", m.Confirmation.Confirmation)}},
+			}
+			table.Body = &simpletable.Body{Cells: cells}
+
+			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+				{Align: simpletable.AlignRight, Span: 2, Text: "Parsed confirmation data"},
+			}}
+
+			table.SetStyle(simpletable.StyleUnicode)
+			msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+		}
+		msg.WriteString(r.Colors.infoColor(fmt.Sprintf("\n%s\n  %s\nReply: [y/N]\n", m.Confirmation.Title, m.Confirmation.Message)))
+	}
+
+	if len(m.References) > 0 {
+		// When debug mode is turned off, the refrerences are not explicitly displayed
+		if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+			msg.WriteString(r.Colors.debugColor("\nHuzzah! You successfully received some references!\n"))
+
+			table := simpletable.New()
+			table.Header = &simpletable.Header{
+				Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignLeft, Text: "index"},
+					{Align: simpletable.AlignLeft, Text: "id"},
+					{Align: simpletable.AlignLeft, Text: "type"},
+					{Align: simpletable.AlignLeft, Text: "data"},
+					{Align: simpletable.AlignLeft, Text: "display_icon"},
+					{Align: simpletable.AlignLeft, Text: "display_name"},
+					{Align: simpletable.AlignLeft, Text: "display_url"},
+				},
+			}
+
+			var cells [][]*simpletable.Cell
+			for i, reference := range m.References {
+				cells = append(cells, []*simpletable.Cell{
+					{Text: fmt.Sprintf("%d", i)},
+					{Text: reference.ID},
+					{Text: reference.Type},
+					{Text: fmt.Sprintf("[condensed] %.20s", reference.Data)},
+					{Text: reference.Metadata.DisplayIcon},
+					{Text: reference.Metadata.DisplayName},
+					{Text: reference.Metadata.DisplayURL},
+				})
+
+			}
+			table.Body = &simpletable.Body{Cells: cells}
+
+			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+				{Align: simpletable.AlignRight, Span: 7, Text: "Parsed references data"},
+			}}
+
+			table.SetStyle(simpletable.StyleUnicode)
+			msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+		}
+
+		for i, reference := range m.References {
+			msg.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, reference.ID, reference.Metadata.DisplayName))
+		}
+	}
+
+	if len(m.Errors) > 0 {
+		table := simpletable.New()
+
+		if shouldLog(r.LogLevel, LEVEL_DEBUG) {
+			msg.WriteString(r.Colors.debugColor("\nHuzzah! You successfully received some errors!\n"))
+
+			table.Header = &simpletable.Header{
+				Cells: []*simpletable.Cell{
+					{Align: simpletable.AlignLeft, Text: "index"},
+					{Align: simpletable.AlignLeft, Text: "message"},
+					{Align: simpletable.AlignLeft, Text: "type"},
+					{Align: simpletable.AlignLeft, Text: "code"},
+					{Align: simpletable.AlignLeft, Text: "identifier"},
+				},
+			}
+
+			var cells [][]*simpletable.Cell
+			for i, error := range m.Errors {
+				cells = append(cells, []*simpletable.Cell{
+					{Text: fmt.Sprintf("%d", i)},
+					{Text: error.Message},
+					{Text: error.Type},
+					{Text: error.Code},
+					{Text: error.Identifier},
+				})
+			}
+			table.Body = &simpletable.Body{Cells: cells}
+
+			table.Footer = &simpletable.Footer{Cells: []*simpletable.Cell{
+				{Align: simpletable.AlignRight, Span: 5, Text: "Parsed error data"},
+			}}
+
+			table.SetStyle(simpletable.StyleUnicode)
+			msg.WriteString(fmt.Sprintf("%s\n", r.Colors.debugColor(table.String())))
+		}
+
+		// agent errors fail the whole response, so they are shown apart from
+		// the errors about a single reference or function call
+		var i int
+		for _, error := range m.Errors {
+			if error.Type == ErrorTypeAgent {
+				msg.WriteString(r.Colors.errorColor(fmt.Sprintf("Alas...The agent failed: %s (%s)\n", error.Message, error.Code)))
+				continue
+			}
+
+			i++
+			msg.WriteString(fmt.Sprintf("%d. %s error on %s: %s (%s)\n", i, error.Type, error.Identifier, error.Message, error.Code))
+		}
+	}
+
+	return msg.String()
+}
+
+// formatCreated formats the unix time a completion was created at.
+func formatCreated(created int64) string {
+	if created == 0 {
+		return ""
+	}
+	return time.Unix(created, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,524 @@
+package chat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// errInterrupted is returned by a lineReader when the user pressed Ctrl+C
+// while it was waiting for input.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the lines the user types.
+type lineReader interface {
+	// ReadLine writes the prompt and returns the next line, io.EOF at the end
+	// of the input, or errInterrupted.
+	ReadLine(prompt string) (string, error)
+
+	// Remember adds a message, which may span several lines, to the input
+	// history of readers keeping one.
+	Remember(message string)
+}
+
+// scannerReader reads lines from input that is not a terminal, e.g. a pipe.
+type scannerReader struct {
+	out        io.Writer
+	lines      <-chan string
+	scanner    *bufio.Scanner
+	interrupts <-chan os.Signal
+}
+
+func newScannerReader(in io.Reader, out io.Writer, interrupts <-chan os.Signal) *scannerReader {
+	scanner := bufio.NewScanner(in)
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return &scannerReader{out: out, lines: lines, scanner: scanner, interrupts: interrupts}
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	if _, err := io.WriteString(r.out, prompt); err != nil {
+		return "", fmt.Errorf("error writing to stdout: %w", err)
+	}
+
+	select {
+	case <-r.interrupts:
+		return "", errInterrupted
+	case line, ok := <-r.lines:
+		if !ok {
+			if err := r.scanner.Err(); err != nil {
+				return "", fmt.Errorf("error reading from stdin: %w", err)
+			}
+			return "", io.EOF
+		}
+		return line, nil
+	}
+}
+
+// Remember does nothing, as piped input has no history to recall.
+func (r *scannerReader) Remember(message string) {}
+
+// maxHistory is the number of messages kept in the input history.
+const maxHistory = 1000
+
+// HistoryPath returns the path of the input history file of a profile, in the
+// user's config directory.
+func HistoryPath(profile string) (string, error) {
+	if profile == "" || strings.ContainsAny(profile, `/\`) || profile == "." || profile == ".." {
+		return "", fmt.Errorf("invalid profile name %q", profile)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find the config directory: %w", err)
+	}
+	return filepath.Join(dir, "gh-debug-cli", "history", profile), nil
+}
+
+// lineEditor reads lines from a terminal with readline-style editing, an input
+// history recalled with the arrow keys and searched with Ctrl+R, and persisted
+// to a file with its secrets masked by redactor.
+type lineEditor struct {
+	in          *os.File
+	out         *os.File
+	keys        *bufio.Reader
+	history     []string
+	historyFile string
+	redactor    *Redactor
+}
+
+// newLineEditor creates a lineEditor, loading the history from historyFile
+// unless it is empty.
+func newLineEditor(in *os.File, out *os.File, historyFile string, redactor *Redactor) (*lineEditor, error) {
+	e := &lineEditor{in: in, out: out, keys: bufio.NewReader(in), historyFile: historyFile, redactor: redactor}
+	if historyFile == "" {
+		return e, nil
+	}
+
+	b, err := os.ReadFile(historyFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not open history file: %w", err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			e.history = append(e.history, unescapeHistory(line))
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	return e, nil
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	state, err := term.MakeRaw(int(e.in.Fd()))
+	if err != nil {
+		return "", fmt.Errorf("error setting up the terminal: %w", err)
+	}
+	defer term.Restore(int(e.in.Fd()), state)
+
+	ed := &editState{prompt: prompt, history: e.history, recall: len(e.history)}
+	for {
+		width, _, err := term.GetSize(int(e.out.Fd()))
+		if err != nil {
+			width = 80
+		}
+		if _, err := io.WriteString(e.out, ed.view(width)); err != nil {
+			return "", fmt.Errorf("error writing to stdout: %w", err)
+		}
+
+		k, err := readKey(e.keys)
+		if err != nil {
+			return "", err
+		}
+
+		switch ed.handleKey(k) {
+		case editSubmit:
+			line := string(ed.buf.text)
+			// the raw terminal does not turn \n into \r\n
+			io.WriteString(e.out, ed.view(width)+"\r\n")
+			return line, nil
+		case editEOF:
+			io.WriteString(e.out, "\r\n")
+			return "", io.EOF
+		case editInterrupt:
+			io.WriteString(e.out, "\r\n")
+			return "", errInterrupted
+		case editClear:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		}
+	}
+}
+
+// Remember adds a message to the history, and appends it to the history file
+// on a line of its own. Failing to write the file is not worth ending the
+// session over.
+func (e *lineEditor) Remember(message string) {
+	if strings.TrimSpace(message) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == message) {
+		return
+	}
+	e.history = append(e.history, message)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.historyFile), 0o700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, escapeHistory(e.redactor.String(message)))
+}
+
+var (
+	historyEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	historyUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+)
+
+// escapeHistory escapes the backslashes and newlines of a message, so it takes
+// a single line of the history file.
+func escapeHistory(message string) string {
+	return historyEscaper.Replace(message)
+}
+
+// unescapeHistory reverses escapeHistory.
+func unescapeHistory(line string) string {
+	return historyUnescaper.Replace(line)
+}
+
+// lineBuffer is the line being edited, with the cursor at pos.
+type lineBuffer struct {
+	text []rune
+	pos  int
+}
+
+func (b *lineBuffer) set(s string) {
+	b.text = []rune(s)
+	b.pos = len(b.text)
+}
+
+func (b *lineBuffer) insert(r rune) {
+	b.text = append(b.text[:b.pos], append([]rune{r}, b.text[b.pos:]...)...)
+	b.pos++
+}
+
+func (b *lineBuffer) backspace() {
+	if b.pos > 0 {
+		b.text = append(b.text[:b.pos-1], b.text[b.pos:]...)
+		b.pos--
+	}
+}
+
+func (b *lineBuffer) delete() {
+	if b.pos < len(b.text) {
+		b.text = append(b.text[:b.pos], b.text[b.pos+1:]...)
+	}
+}
+
+// deleteWord deletes the word before the cursor, and the spaces after it.
+func (b *lineBuffer) deleteWord() {
+	start := b.pos
+	for start > 0 && unicode.IsSpace(b.text[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(b.text[start-1]) {
+		start--
+	}
+	b.text = append(b.text[:start], b.text[b.pos:]...)
+	b.pos = start
+}
+
+type editAction int
+
+const (
+	editNone editAction = iota
+	editSubmit
+	editEOF
+	editInterrupt
+	editClear
+)
+
+// editState is the state of the line editor while reading a line.
+type editState struct {
+	prompt  string
+	buf     lineBuffer
+	history []string
+
+	// recall is the index of the history line shown, len(history) for the
+	// line being typed, which is kept in draft.
+	recall int
+	draft  string
+
+	// searching is set during a reverse search for query, which matched the
+	// history line at match, or -1 when no line matches.
+	searching bool
+	query     []rune
+	match     int
+	original  string
+}
+
+func (ed *editState) handleKey(k tuiKey) editAction {
+	if ed.searching {
+		return ed.handleSearchKey(k)
+	}
+
+	switch k.code {
+	case keyRune:
+		ed.buf.insert(k.r)
+	case keyTab:
+		ed.buf.insert('\t')
+	case keyEnter:
+		return editSubmit
+	case keyBackspace:
+		ed.buf.backspace()
+	case keyDelete:
+		ed.buf.delete()
+	case keyLeft:
+		ed.buf.pos = max(ed.buf.pos-1, 0)
+	case keyRight:
+		ed.buf.pos = min(ed.buf.pos+1, len(ed.buf.text))
+	case keyHome, keyCtrlA:
+		ed.buf.pos = 0
+	case keyEnd, keyCtrlE:
+		ed.buf.pos = len(ed.buf.text)
+	case keyCtrlK:
+		ed.buf.text = ed.buf.text[:ed.buf.pos]
+	case keyCtrlU:
+		ed.buf.text = ed.buf.text[ed.buf.pos:]
+		ed.buf.pos = 0
+	case keyCtrlW:
+		ed.buf.deleteWord()
+	case keyUp, keyCtrlP:
+		ed.recallLine(ed.recall - 1)
+	case keyDown, keyCtrlN:
+		ed.recallLine(ed.recall + 1)
+	case keyCtrlR:
+		ed.searching = true
+		ed.query = nil
+		ed.match = -1
+		ed.original = string(ed.buf.text)
+	case keyCtrlL:
+		return editClear
+	case keyCtrlC:
+		// Ctrl+C clears the line, and ends the session on an empty one
+		if len(ed.buf.text) == 0 {
+			return editInterrupt
+		}
+		ed.buf.set("")
+	case keyCtrlD:
+		if len(ed.buf.text) == 0 {
+			return editEOF
+		}
+		ed.buf.delete()
+	}
+	return editNone
+}
+
+// recallLine shows the history line at index i, or the line being typed past
+// the end of the history.
+func (ed *editState) recallLine(i int) {
+	if i < 0 || i > len(ed.history) || i == ed.recall {
+		return
+	}
+	if ed.recall == len(ed.history) {
+		ed.draft = string(ed.buf.text)
+	}
+	ed.recall = i
+	if i == len(ed.history) {
+		ed.buf.set(ed.draft)
+	} else {
+		ed.buf.set(ed.history[i])
+	}
+}
+
+func (ed *editState) handleSearchKey(k tuiKey) editAction {
+	switch k.code {
+	case keyRune:
+		ed.query = append(ed.query, k.r)
+		ed.match = ed.find(len(ed.history) - 1)
+	case keyBackspace:
+		if len(ed.query) > 0 {
+			ed.query = ed.query[:len(ed.query)-1]
+			ed.match = ed.find(len(ed.history) - 1)
+		}
+	case keyCtrlR:
+		// look for an older match, keeping this one if there is none
+		if i := ed.find(ed.match - 1); ed.match > 0 && i >= 0 {
+			ed.match = i
+		}
+	case keyCtrlC, keyCtrlG, keyEsc:
+		ed.searching = false
+		ed.buf.set(ed.original)
+	case keyEnter:
+		if ed.match < 0 {
+			// nothing to submit, so go back to the line being typed
+			ed.searching = false
+			ed.buf.set(ed.original)
+			return editNone
+		}
+		ed.acceptSearch()
+		return editSubmit
+	default:
+		// any other key keeps the match to edit it
+		ed.acceptSearch()
+		return ed.handleKey(k)
+	}
+	return editNone
+}
+
+// find returns the index of the most recent history line containing the
+// query, from the line at index from back to the oldest one, or -1.
+func (ed *editState) find(from int) int {
+	if len(ed.query) == 0 {
+		return -1
+	}
+	for i := min(from, len(ed.history)-1); i >= 0; i-- {
+		if strings.Contains(ed.history[i], string(ed.query)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ed *editState) acceptSearch() {
+	ed.searching = false
+	if ed.match >= 0 {
+		ed.buf.set(ed.history[ed.match])
+		ed.recall = ed.match
+	} else {
+		ed.buf.set(ed.original)
+	}
+}
+
+var ansiCodes = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// view redraws the line being edited. Lines wider than the terminal scroll
+// horizontally to keep the cursor in view.
+func (ed *editState) view(width int) string {
+	prompt := ed.prompt
+	text, pos := ed.buf.text, ed.buf.pos
+	if ed.searching {
+		prompt = fmt.Sprintf("(reverse-i-search)`%s': ", string(ed.query))
+		if len(ed.query) > 0 && ed.match < 0 {
+			prompt = "(failing " + prompt[1:]
+		}
+		text, pos = nil, 0
+		if ed.match >= 0 {
+			line := ed.history[ed.match]
+			text = []rune(line)
+			if i := strings.Index(line, string(ed.query)); i >= 0 {
+				pos = len([]rune(line[:i]))
+			}
+		}
+	}
+
+	// messages recalled from the history may span several lines, which are
+	// shown joined on the one being edited
+	text = []rune(strings.ReplaceAll(string(text), "\n", "↵"))
+
+	room := max(width-runewidth.StringWidth(ansiCodes.ReplaceAllString(prompt, ""))-1, 1)
+	start := 0
+	for runewidth.StringWidth(string(text[start:pos])) > room {
+		start++
+	}
+	end := start
+	for end < len(text) && runewidth.StringWidth(string(text[start:end+1])) <= room {
+		end++
+	}
+
+	visible := strings.ReplaceAll(string(text[start:end]), "\t", " ")
+	cursor := runewidth.StringWidth(string(text[start:pos]))
+	line := "\r" + prompt + visible + "\x1b[K\r" + prompt
+	if cursor > 0 {
+		line += fmt.Sprintf("\x1b[%dC", cursor)
+	}
+	return line
+}
+
+const (
+	// pasteCommand starts a multi-line message, ended by a pasteEnd line.
+	pasteCommand = "/paste"
+	pasteEnd     = "/end"
+
+	// continuePrompt is shown for the lines after the first of a multi-line
+	// message.
+	continuePrompt = "... "
+)
+
+// readMessage reads the next message, which spans several lines when a line
+// opens a code block with ``` until the block is closed, or between /paste and
+// /end lines.
+func readMessage(r lineReader, prompt string) (string, error) {
+	line, err := r.ReadLine(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(line) == pasteCommand {
+		var lines []string
+		for {
+			l, err := r.ReadLine(continuePrompt)
+			if errors.Is(err, io.EOF) || (err == nil && strings.TrimSpace(l) == pasteEnd) {
+				message := strings.Join(lines, "\n")
+				r.Remember(message)
+				return message, nil
+			}
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, l)
+		}
+	}
+
+	lines := []string{line}
+	open := strings.Count(line, "```")%2 == 1
+	for open {
+		l, err := r.ReadLine(continuePrompt)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, l)
+		open = open != (strings.Count(l, "```")%2 == 1)
+	}
+	message := strings.Join(lines, "\n")
+	r.Remember(message)
+	return message, nil
+}
+
+// newLineReader returns a lineEditor when chatting on a terminal, and a
+// scannerReader otherwise. The history is written with its secrets masked by
+// redactor.
+func newLineReader(opts Options, interrupts <-chan os.Signal, redactor *Redactor) (lineReader, error) {
+	in, inOK := opts.In.(*os.File)
+	out, outOK := opts.Out.(*os.File)
+	if inOK && outOK && isTerminal(in) && isTerminal(out) {
+		// the platform may not support raw mode
+		if state, err := term.MakeRaw(int(in.Fd())); err == nil {
+			term.Restore(int(in.Fd()), state)
+			return newLineEditor(in, out, opts.HistoryFile, redactor)
+		}
+	}
+	return newScannerReader(opts.In, opts.Out, interrupts), nil
+}
@@ -0,0 +1,259 @@
+package chat
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func typeKeys(ed *editState, s string) {
+	for _, r := range s {
+		ed.handleKey(tuiKey{code: keyRune, r: r})
+	}
+}
+
+func TestEditState_Editing(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []tuiKey
+		want string
+		pos  int
+	}{
+		{name: "insert_in_middle", keys: []tuiKey{{code: keyLeft}, {code: keyLeft}, {code: keyRune, r: 'X'}}, want: "hello worXld", pos: 10},
+		{name: "backspace", keys: []tuiKey{{code: keyBackspace}}, want: "hello worl", pos: 10},
+		{name: "delete_at_start", keys: []tuiKey{{code: keyCtrlA}, {code: keyDelete}}, want: "ello world", pos: 0},
+		{name: "kill_to_end", keys: []tuiKey{{code: keyHome}, {code: keyRight}, {code: keyCtrlK}}, want: "h", pos: 1},
+		{name: "kill_to_start", keys: []tuiKey{{code: keyLeft}, {code: keyCtrlU}}, want: "d", pos: 0},
+		{name: "delete_word", keys: []tuiKey{{code: keyCtrlW}}, want: "hello ", pos: 6},
+		{name: "ctrl_c_clears", keys: []tuiKey{{code: keyCtrlC}}, want: "", pos: 0},
+		{name: "ctrl_d_deletes", keys: []tuiKey{{code: keyCtrlA}, {code: keyCtrlD}, {code: keyEnd}}, want: "ello world", pos: 10},
+		{name: "cursor_stays_in_line", keys: []tuiKey{{code: keyRight}, {code: keyCtrlA}, {code: keyLeft}}, want: "hello world", pos: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ed := &editState{}
+			typeKeys(ed, "hello world")
+			for _, k := range tt.keys {
+				assert.Equal(t, editNone, ed.handleKey(k))
+			}
+			assert.Equal(t, tt.want, string(ed.buf.text))
+			assert.Equal(t, tt.pos, ed.buf.pos)
+		})
+	}
+}
+
+func TestEditState_Actions(t *testing.T) {
+	ed := &editState{}
+	assert.Equal(t, editInterrupt, ed.handleKey(tuiKey{code: keyCtrlC}))
+	assert.Equal(t, editEOF, ed.handleKey(tuiKey{code: keyCtrlD}))
+	assert.Equal(t, editClear, ed.handleKey(tuiKey{code: keyCtrlL}))
+	assert.Equal(t, editSubmit, ed.handleKey(tuiKey{code: keyEnter}))
+}
+
+func TestEditState_History(t *testing.T) {
+	history := []string{"first", "second"}
+	ed := &editState{history: history, recall: len(history)}
+	typeKeys(ed, "draft")
+
+	ed.handleKey(tuiKey{code: keyUp})
+	assert.Equal(t, "second", string(ed.buf.text))
+	ed.handleKey(tuiKey{code: keyUp})
+	ed.handleKey(tuiKey{code: keyUp})
+	assert.Equal(t, "first", string(ed.buf.text))
+	ed.handleKey(tuiKey{code: keyDown})
+	ed.handleKey(tuiKey{code: keyDown})
+	assert.Equal(t, "draft", string(ed.buf.text), "the line being typed is kept")
+	ed.handleKey(tuiKey{code: keyDown})
+	assert.Equal(t, "draft", string(ed.buf.text))
+}
+
+func TestEditState_ReverseSearch(t *testing.T) {
+	history := []string{"show references", "hello", "show confirmation"}
+
+	t.Run("submit_match", func(t *testing.T) {
+		ed := &editState{history: history, recall: len(history)}
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		typeKeys(ed, "show")
+		assert.Equal(t, 2, ed.match)
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		assert.Equal(t, 0, ed.match, "Ctrl+R looks for an older match")
+		assert.Equal(t, "\r(reverse-i-search)`show': show references\x1b[K\r(reverse-i-search)`show': ", ed.view(80))
+
+		assert.Equal(t, editSubmit, ed.handleKey(tuiKey{code: keyEnter}))
+		assert.Equal(t, "show references", string(ed.buf.text))
+	})
+
+	t.Run("edit_match", func(t *testing.T) {
+		ed := &editState{history: history, recall: len(history)}
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		typeKeys(ed, "hel")
+		assert.Equal(t, editNone, ed.handleKey(tuiKey{code: keyEnd}))
+		typeKeys(ed, "!")
+		assert.False(t, ed.searching)
+		assert.Equal(t, "hello!", string(ed.buf.text))
+	})
+
+	t.Run("no_match", func(t *testing.T) {
+		ed := &editState{history: history, recall: len(history)}
+		typeKeys(ed, "typed")
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		typeKeys(ed, "hz")
+		assert.Equal(t, -1, ed.match, "the match of h is dropped")
+		assert.Equal(t, "\r(failing reverse-i-search)`hz': \x1b[K\r(failing reverse-i-search)`hz': ", ed.view(80))
+
+		ed.handleKey(tuiKey{code: keyBackspace})
+		assert.Equal(t, 2, ed.match)
+
+		typeKeys(ed, "z")
+		assert.Equal(t, editNone, ed.handleKey(tuiKey{code: keyEnter}), "nothing is submitted")
+		assert.False(t, ed.searching)
+		assert.Equal(t, "typed", string(ed.buf.text))
+	})
+
+	t.Run("no_older_match", func(t *testing.T) {
+		ed := &editState{history: history, recall: len(history)}
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		typeKeys(ed, "hello")
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		assert.Equal(t, 1, ed.match)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ed := &editState{history: history, recall: len(history)}
+		typeKeys(ed, "typed")
+		ed.handleKey(tuiKey{code: keyCtrlR})
+		typeKeys(ed, "show")
+		ed.handleKey(tuiKey{code: keyCtrlG})
+		assert.False(t, ed.searching)
+		assert.Equal(t, "typed", string(ed.buf.text))
+	})
+}
+
+func TestEditState_View(t *testing.T) {
+	ed := &editState{prompt: "\x1b[32mme\x1b[0m: "}
+	typeKeys(ed, "hello")
+	assert.Equal(t, "\r\x1b[32mme\x1b[0m: hello\x1b[K\r\x1b[32mme\x1b[0m: \x1b[5C", ed.view(80))
+
+	// lines wider than the terminal scroll to keep the cursor in view
+	ed = &editState{prompt: "> "}
+	typeKeys(ed, "abcdefghij")
+	assert.Equal(t, "\r> fghij\x1b[K\r> \x1b[5C", ed.view(8))
+	ed.handleKey(tuiKey{code: keyHome})
+	assert.Equal(t, "\r> abcde\x1b[K\r> ", ed.view(8))
+}
+
+func TestEditState_RecallMultiLine(t *testing.T) {
+	ed := &editState{prompt: "> ", history: []string{"a\nb"}, recall: 1}
+	ed.handleKey(tuiKey{code: keyUp})
+	assert.Equal(t, "\r> a↵b\x1b[K\r> \x1b[3C", ed.view(80))
+	assert.Equal(t, editSubmit, ed.handleKey(tuiKey{code: keyEnter}))
+	assert.Equal(t, "a\nb", string(ed.buf.text))
+}
+
+func TestLineEditor_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "default")
+	redactor, err := NewRedactor()
+	require.NoError(t, err)
+
+	e, err := newLineEditor(nil, nil, path, redactor)
+	require.NoError(t, err)
+	e.Remember("hello")
+	e.Remember("hello")
+	e.Remember("  ")
+	e.Remember("fix this ```go\nx := `a\\n`\n```")
+	e.Remember("again")
+
+	e, err = newLineEditor(nil, nil, path, redactor)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "fix this ```go\nx := `a\\n`\n```", "again"}, e.history)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestLineEditor_History_Redacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "default")
+	redactor, err := NewRedactor()
+	require.NoError(t, err)
+
+	e, err := newLineEditor(nil, nil, path, redactor)
+	require.NoError(t, err)
+	e.Remember("is " + testGitHubToken + " valid?")
+
+	// the session recalls the message as typed, the file keeps it masked
+	assert.Equal(t, []string{"is " + testGitHubToken + " valid?"}, e.history)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "is [REDACTED] valid?\n", string(b))
+}
+
+func TestHistoryPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/config")
+	t.Setenv("HOME", "/home/octocat")
+
+	path, err := HistoryPath("blackbeard")
+	require.NoError(t, err)
+	assert.Equal(t, "blackbeard", filepath.Base(path))
+	assert.Equal(t, "history", filepath.Base(filepath.Dir(path)))
+
+	for _, profile := range []string{"", "..", "a/b"} {
+		_, err := HistoryPath(profile)
+		assert.EqualError(t, err, `invalid profile name "`+profile+`"`)
+	}
+}
+
+// fakeLineReader returns its lines, then io.EOF.
+type fakeLineReader struct {
+	lines      []string
+	prompts    []string
+	remembered []string
+}
+
+func (r *fakeLineReader) Remember(message string) {
+	r.remembered = append(r.remembered, message)
+}
+
+func (r *fakeLineReader) ReadLine(prompt string) (string, error) {
+	r.prompts = append(r.prompts, prompt)
+	if len(r.lines) == 0 {
+		return "", io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return line, nil
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    string
+		prompts []string
+	}{
+		{name: "single_line", lines: []string{"hello", "next"}, want: "hello", prompts: []string{"me: "}},
+		{name: "code_block", lines: []string{"fix this ```go", "x := 1", "```", "next"}, want: "fix this ```go\nx := 1\n```", prompts: []string{"me: ", "... ", "... "}},
+		{name: "inline_code", lines: []string{"run ```ls``` please", "next"}, want: "run ```ls``` please", prompts: []string{"me: "}},
+		{name: "unclosed_code_block", lines: []string{"```", "x"}, want: "```\nx", prompts: []string{"me: ", "... ", "... "}},
+		{name: "paste", lines: []string{"/paste", "line one", "", "```", "/end", "next"}, want: "line one\n\n```", prompts: []string{"me: ", "... ", "... ", "... ", "... "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &fakeLineReader{lines: tt.lines}
+			msg, err := readMessage(r, "me: ")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, msg)
+			assert.Equal(t, tt.prompts, r.prompts)
+			assert.Equal(t, []string{tt.want}, r.remembered, "the message is one history entry")
+		})
+	}
+
+	_, err := readMessage(&fakeLineReader{}, "me: ")
+	assert.ErrorIs(t, err, io.EOF)
+}
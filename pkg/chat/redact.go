@@ -0,0 +1,167 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the secrets a Redactor masks.
+const Redacted = "[REDACTED]"
+
+// minSecretLength is the length under which exact secrets are not masked,
+// since shorter values are too likely to appear in ordinary output, e.g. a
+// token of "token" in the hint about --token.
+const minSecretLength = 8
+
+// SensitiveHeaders are the headers whose values are always masked.
+var SensitiveHeaders = []string{
+	"X-GitHub-Token",
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Github-Public-Key-Signature",
+	"X-Hub-Signature",
+	"X-Hub-Signature-256",
+}
+
+var (
+	// sensitiveHeaderLine matches a sensitive header in an HTTP dump, keeping
+	// its name.
+	sensitiveHeaderLine = regexp.MustCompile(`(?im)^([ \t]*(?:` + strings.Join(quoteAll(SensitiveHeaders), "|") + `)[ \t]*:[ \t]*)[^\r\n]+`)
+
+	// sensitiveJSONField matches a string field of a JSON body that holds a
+	// secret, keeping its name.
+	sensitiveJSONField = regexp.MustCompile(`(?i)("(?:x-github-token|token|access_token|refresh_token|authorization|signature|private_key|secret)"\s*:\s*")(?:[^"\\]|\\.)*"`)
+)
+
+// DefaultSecretPatterns match the GitHub tokens and private keys masked by
+// every Redactor.
+var DefaultSecretPatterns = []string{
+	// personal access, OAuth, user-to-server, server-to-server and refresh tokens
+	`\bgh[pousr]_[A-Za-z0-9]{20,}`,
+	// fine-grained personal access tokens
+	`\bgithub_pat_[A-Za-z0-9_]{20,}`,
+	// PEM private keys, also when their newlines are escaped in JSON
+	`-----BEGIN[A-Z ]* PRIVATE KEY-----[\s\S]*?-----END[A-Z ]* PRIVATE KEY-----`,
+}
+
+// Redactor masks tokens, signatures, key material and other secrets in the
+// logs and output of the CLI, so they can be pasted into issues. A nil
+// Redactor masks nothing.
+type Redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor creates a Redactor masking the DefaultSecretPatterns, the
+// sensitive headers and JSON fields, and the matches of the given regular
+// expressions.
+func NewRedactor(patterns ...string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range append(DefaultSecretPatterns[:len(DefaultSecretPatterns):len(DefaultSecretPatterns)], patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// AddSecret masks every occurrence of a value, e.g. the token passed on the
+// command line. Values shorter than 8 characters are ignored.
+func (r *Redactor) AddSecret(secret string) {
+	if r == nil || len(secret) < minSecretLength {
+		return
+	}
+	r.secrets = append(r.secrets, secret)
+}
+
+// String returns s with its secrets masked.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	s = sensitiveHeaderLine.ReplaceAllString(s, "${1}"+Redacted)
+	s = sensitiveJSONField.ReplaceAllString(s, `${1}`+Redacted+`"`)
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, Redacted)
+	}
+	return s
+}
+
+// Bytes returns b with its secrets masked.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
+
+// Header returns a copy of h with the values of the sensitive headers and the
+// secrets in the others masked.
+func (r *Redactor) Header(h http.Header) http.Header {
+	if r == nil || h == nil {
+		return h
+	}
+
+	masked := make(http.Header, len(h))
+	for name, values := range h {
+		masked[name] = make([]string, len(values))
+		for i, v := range values {
+			if isSensitiveHeader(name) {
+				masked[name][i] = Redacted
+			} else {
+				masked[name][i] = r.String(v)
+			}
+		}
+	}
+	return masked
+}
+
+// Writer returns a writer masking the secrets in every write to w. Secrets
+// split across writes are not masked, so whole messages should be written at
+// once.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &redactingWriter{w: w, r: r}
+}
+
+type redactingWriter struct {
+	w io.Writer
+	r *Redactor
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(w.r.Bytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func isSensitiveHeader(name string) bool {
+	for _, h := range SensitiveHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return quoted
+}
@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ReferenceType is a kind of reference Copilot knows how to display, along
+// with the schema of its data.
+type ReferenceType struct {
+	Type   string  `json:"type"`
+	Schema *Schema `json:"schema"`
+}
+
+// referenceTypes holds the well-known reference types, by type. Copilot does
+// not document the data of these types, so their schemas only check the types
+// of the fields Copilot is known to read, and require none of them.
+var referenceTypes = map[string]*Schema{
+	"github.repository": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":          {Type: "integer"},
+			"name":        {Type: "string"},
+			"ownerLogin":  {Type: "string"},
+			"ownerType":   {Type: "string", Enum: []any{"User", "Organization"}},
+			"description": {Type: "string"},
+			"visibility":  {Type: "string", Enum: []any{"public", "private", "internal"}},
+		},
+	},
+	"github.file": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"path":       {Type: "string"},
+			"ref":        {Type: "string"},
+			"repository": {Type: "string"},
+			"url":        {Type: "string", Format: "uri"},
+		},
+	},
+	"github.issue": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"number":     {Type: "integer"},
+			"title":      {Type: "string"},
+			"state":      {Type: "string", Enum: []any{"open", "closed"}},
+			"repository": {Type: "string"},
+			"url":        {Type: "string", Format: "uri"},
+		},
+	},
+	"github.pull_request": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"number":     {Type: "integer"},
+			"title":      {Type: "string"},
+			"state":      {Type: "string", Enum: []any{"open", "closed", "merged"}},
+			"repository": {Type: "string"},
+			"url":        {Type: "string", Format: "uri"},
+		},
+	},
+	"github.snippet": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"path":       {Type: "string"},
+			"content":    {Type: "string"},
+			"language":   {Type: "string"},
+			"repository": {Type: "string"},
+		},
+	},
+	"client.file": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"content":  {Type: "string"},
+			"language": {Type: "string"},
+		},
+	},
+	"client.selection": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"content": {Type: "string"},
+		},
+	},
+	"web-search": {
+		Type: "object",
+		Properties: map[string]*Schema{
+			"query": {Type: "string"},
+			"results": {
+				Type: "array",
+				Items: &Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"title":   {Type: "string"},
+						"url":     {Type: "string", Format: "uri"},
+						"excerpt": {Type: "string"},
+					},
+				},
+			},
+		},
+	},
+}
+
+// ReferenceTypes returns the well-known reference types, sorted by type.
+func ReferenceTypes() []ReferenceType {
+	types := make([]ReferenceType, 0, len(referenceTypes))
+	for t, schema := range referenceTypes {
+		types = append(types, ReferenceType{Type: t, Schema: schema})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types
+}
+
+// referenceTypesConfig is the format of a reference schemas file.
+type referenceTypesConfig struct {
+	Types map[string]*Schema `json:"types"`
+}
+
+// RegisterReferenceType adds a custom reference type, or replaces the schema of
+// a well-known one.
+func (rs *RuleSet) RegisterReferenceType(t string, schema *Schema) {
+	rs.referenceTypes[t] = schema
+}
+
+// LoadReferenceTypes registers the custom reference types in a JSON schema
+// file of the form
+// {"types": {"acme.ticket": {"type": "object", "required": ["key"]}}}.
+func (rs *RuleSet) LoadReferenceTypes(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+
+	var config referenceTypesConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return fmt.Errorf("error parsing reference schemas: %w", err)
+	}
+
+	for t, schema := range config.Types {
+		rs.RegisterReferenceType(t, schema)
+	}
+	return nil
+}
+
+// referenceSchema returns the schema of the data of a reference type, and
+// whether the type is known.
+func (rs *RuleSet) referenceSchema(t string) (*Schema, bool) {
+	if schema, ok := rs.referenceTypes[t]; ok {
+		return schema, true
+	}
+	schema, ok := referenceTypes[t]
+	return schema, ok
+}
+
+// isDisplayIcon reports whether s can be displayed as an icon: an absolute
+// url, or an inline image.
+func isDisplayIcon(s string) bool {
+	return isAbsoluteURL(s) || strings.HasPrefix(s, "data:image/")
+}
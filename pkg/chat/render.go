@@ -0,0 +1,292 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Turn is a user message and the agent's response to it.
+type Turn struct {
+	Username string
+	Prompt   string
+
+	// Response is nil when the turn failed with Err.
+	Response *Response
+	Err      error
+}
+
+// NoticeLevel is the kind of a Notice.
+type NoticeLevel string
+
+const (
+	// NoticeBanner greets the user when an interactive session starts.
+	NoticeBanner NoticeLevel = "banner"
+	NoticeInfo   NoticeLevel = "info"
+	NoticeError  NoticeLevel = "error"
+)
+
+// Notice is a message from the session itself rather than from the agent,
+// e.g. the banner, or why a command could not run.
+type Notice struct {
+	Level NoticeLevel
+	Text  string
+}
+
+// Renderer displays a chat session.
+type Renderer interface {
+	// Prompt is written before reading every user message.
+	Prompt(w io.Writer, username string) error
+
+	// Turn is written once the agent responded to a user message, or failed
+	// to.
+	Turn(w io.Writer, turn Turn) error
+
+	// Notice is written for the messages of the session itself.
+	Notice(w io.Writer, notice Notice) error
+}
+
+// The output formats supported by NewRenderer.
+const (
+	OutputPretty   = "pretty"
+	OutputPlain    = "plain"
+	OutputJSON     = "json"
+	OutputMarkdown = "markdown"
+)
+
+// RenderOptions configures the renderers created by NewRenderer.
+type RenderOptions struct {
+	LogLevel      string
+	Markdown      bool
+	CheckMarkdown bool
+
+	// Colors colors the pretty output. The zero Colors leaves it plain.
+	Colors Colors
+}
+
+// NewRenderer creates the renderer for an output format.
+func NewRenderer(format string, opts RenderOptions) (Renderer, error) {
+	switch strings.ToLower(format) {
+	case OutputPretty, "":
+		return &PrettyRenderer{LogLevel: opts.LogLevel, Markdown: opts.Markdown, CheckMarkdown: opts.CheckMarkdown, Colors: opts.Colors}, nil
+	case OutputPlain:
+		return &PlainRenderer{}, nil
+	case OutputJSON:
+		return &JSONRenderer{}, nil
+	case OutputMarkdown:
+		return &MarkdownRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("output must be either `pretty`, `plain`, `json`, or `markdown`")
+	}
+}
+
+// JSONRenderer writes every turn as a line of JSON, for scripts.
+type JSONRenderer struct{}
+
+// jsonTurn is the format of a turn written by JSONRenderer.
+type jsonTurn struct {
+	Prompt   string    `json:"prompt"`
+	Response *Response `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func (r *JSONRenderer) Prompt(w io.Writer, username string) error {
+	return nil
+}
+
+// jsonNotice is the format of a notice written by JSONRenderer.
+type jsonNotice struct {
+	Notice string      `json:"notice"`
+	Level  NoticeLevel `json:"level"`
+}
+
+func (r *JSONRenderer) Turn(w io.Writer, turn Turn) error {
+	t := jsonTurn{Prompt: turn.Prompt, Response: turn.Response}
+	if turn.Err != nil {
+		t.Error = turn.Err.Error()
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("error marshaling turn: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// Notice writes the notices as lines of JSON too, leaving out the banner so
+// every line can be parsed.
+func (r *JSONRenderer) Notice(w io.Writer, notice Notice) error {
+	if notice.Level == NoticeBanner {
+		return nil
+	}
+
+	b, err := json.Marshal(jsonNotice{Notice: notice.Text, Level: notice.Level})
+	if err != nil {
+		return fmt.Errorf("error marshaling notice: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// PlainRenderer writes turns as plain text, without colors or tables, e.g.
+// for log files.
+type PlainRenderer struct{}
+
+func (r *PlainRenderer) Prompt(w io.Writer, username string) error {
+	_, err := fmt.Fprintf(w, "%s: ", username)
+	return err
+}
+
+func (r *PlainRenderer) Turn(w io.Writer, turn Turn) error {
+	var msg strings.Builder
+	if turn.Err != nil {
+		msg.WriteString(fmt.Sprintf("error: %s\n", turn.Err))
+	}
+
+	if resp := turn.Response; resp != nil {
+		choices := responseChoices(resp)
+		for _, choice := range choices {
+			if len(choices) > 1 {
+				msg.WriteString(fmt.Sprintf("--- Choice %d ---\n", choice))
+			}
+			for _, m := range resp.Messages {
+				if m.Choice() != choice {
+					continue
+				}
+
+				if m.Content != "" {
+					msg.WriteString(fmt.Sprintf("%s: %s\n", m.Role, m.Content))
+				}
+				if m.FunctionCall != nil {
+					msg.WriteString(fmt.Sprintf("function call: %s(%s)\n", m.FunctionCall.Name, m.FunctionCall.Arguments))
+				}
+				for _, call := range m.ToolCalls {
+					msg.WriteString(fmt.Sprintf("tool call %s: %s(%s)\n", call.ID, call.Function.Name, call.Function.Arguments))
+				}
+				if m.Confirmation != nil {
+					msg.WriteString(fmt.Sprintf("%s\n  %s\nReply: [y/N]\n", m.Confirmation.Title, m.Confirmation.Message))
+				}
+				for i, reference := range m.References {
+					msg.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, reference.ID, reference.Metadata.DisplayName))
+				}
+				for _, e := range m.Errors {
+					msg.WriteString(fmt.Sprintf("%s error on %s: %s (%s)\n", e.Type, e.Identifier, e.Message, e.Code))
+				}
+			}
+		}
+
+		for _, v := range resp.Violations {
+			msg.WriteString(fmt.Sprintf("%s (%s)\n", v, v.Location()))
+		}
+	}
+
+	_, err := io.WriteString(w, msg.String())
+	return err
+}
+
+func (r *PlainRenderer) Notice(w io.Writer, notice Notice) error {
+	var err error
+	switch notice.Level {
+	case NoticeBanner:
+		_, err = fmt.Fprintf(w, "\n%s\n", notice.Text)
+	case NoticeError:
+		_, err = fmt.Fprintf(w, "error: %s\n", notice.Text)
+	default:
+		_, err = fmt.Fprintf(w, "%s\n", notice.Text)
+	}
+	return err
+}
+
+// MarkdownRenderer writes the session as a markdown transcript, e.g. to
+// attach to an issue.
+type MarkdownRenderer struct{}
+
+func (r *MarkdownRenderer) Prompt(w io.Writer, username string) error {
+	return nil
+}
+
+func (r *MarkdownRenderer) Turn(w io.Writer, turn Turn) error {
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("### %s\n\n%s\n\n", turn.Username, turn.Prompt))
+
+	if turn.Err != nil {
+		msg.WriteString(fmt.Sprintf("> **Error:** %s\n\n", strings.ReplaceAll(strings.TrimSpace(turn.Err.Error()), "\n", "\n> ")))
+	}
+
+	if resp := turn.Response; resp != nil {
+		choices := responseChoices(resp)
+		for _, choice := range choices {
+			for _, m := range resp.Messages {
+				if m.Choice() != choice {
+					continue
+				}
+
+				heading := m.Role
+				if heading == "" {
+					heading = "agent"
+				}
+				if len(choices) > 1 {
+					heading = fmt.Sprintf("%s (choice %d)", heading, choice)
+				}
+				msg.WriteString(fmt.Sprintf("### %s\n\n", heading))
+
+				if m.Content != "" {
+					msg.WriteString(m.Content + "\n\n")
+				}
+				if m.FunctionCall != nil {
+					msg.WriteString(fmt.Sprintf("Function call `%s`:\n\n```json\n%s\n```\n\n", m.FunctionCall.Name, m.FunctionCall.Arguments))
+				}
+				for _, call := range m.ToolCalls {
+					msg.WriteString(fmt.Sprintf("Tool call `%s`:\n\n```json\n%s\n```\n\n", call.Function.Name, call.Function.Arguments))
+				}
+				if m.Confirmation != nil {
+					msg.WriteString(fmt.Sprintf("> **%s**\n> %s\n\n", m.Confirmation.Title, m.Confirmation.Message))
+				}
+				if len(m.References) > 0 {
+					msg.WriteString("References:\n\n")
+					for _, reference := range m.References {
+						if reference.Metadata.DisplayURL != "" {
+							msg.WriteString(fmt.Sprintf("- [%s](%s)\n", reference.Metadata.DisplayName, reference.Metadata.DisplayURL))
+						} else {
+							msg.WriteString(fmt.Sprintf("- %s\n", reference.Metadata.DisplayName))
+						}
+					}
+					msg.WriteString("\n")
+				}
+				if len(m.Errors) > 0 {
+					msg.WriteString("Errors:\n\n")
+					for _, e := range m.Errors {
+						msg.WriteString(fmt.Sprintf("- %s error on `%s`: %s (`%s`)\n", e.Type, e.Identifier, e.Message, e.Code))
+					}
+					msg.WriteString("\n")
+				}
+			}
+		}
+
+		if len(resp.Violations) > 0 {
+			msg.WriteString("Protocol violations:\n\n")
+			for _, v := range resp.Violations {
+				msg.WriteString(fmt.Sprintf("- `%s` %s: %s (%s)\n", v.Severity, v.Rule, v.Message, v.Location()))
+			}
+			msg.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, msg.String())
+	return err
+}
+
+// Notice quotes the notices in the transcript, leaving out the banner.
+func (r *MarkdownRenderer) Notice(w io.Writer, notice Notice) error {
+	var err error
+	switch notice.Level {
+	case NoticeBanner:
+	case NoticeError:
+		_, err = fmt.Fprintf(w, "> **Error:** %s\n\n", notice.Text)
+	default:
+		_, err = fmt.Fprintf(w, "> %s\n\n", notice.Text)
+	}
+	return err
+}
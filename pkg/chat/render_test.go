@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRenderer(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected Renderer
+		err      bool
+	}{
+		{format: "", expected: &PrettyRenderer{LogLevel: LEVEL_DEBUG}},
+		{format: OutputPretty, expected: &PrettyRenderer{LogLevel: LEVEL_DEBUG}},
+		{format: OutputPlain, expected: &PlainRenderer{}},
+		{format: "JSON", expected: &JSONRenderer{}},
+		{format: OutputMarkdown, expected: &MarkdownRenderer{}},
+		{format: "yaml", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			r, err := NewRenderer(tt.format, RenderOptions{LogLevel: LEVEL_DEBUG})
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, r)
+		})
+	}
+}
+
+var renderTurn = Turn{
+	Username: "octocat",
+	Prompt:   "hello",
+	Response: &Response{
+		Messages: []*Message{
+			{
+				Role:    "assistant",
+				Content: "Ahoy",
+				References: []Reference{
+					{Type: "github.issue", ID: "1", Metadata: ReferenceMetadata{DisplayName: "Issue 1", DisplayURL: "https://github.com/octo/repo/issues/1"}},
+				},
+			},
+			{
+				Confirmation: &Confirmation{Title: "Sail?", Message: "Leave port now"},
+			},
+		},
+		Violations: []Violation{
+			{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "no done"},
+		},
+	},
+}
+
+func TestPlainRenderer(t *testing.T) {
+	var out bytes.Buffer
+	r := &PlainRenderer{}
+	require.NoError(t, r.Prompt(&out, "octocat"))
+	require.NoError(t, r.Turn(&out, renderTurn))
+	require.NoError(t, r.Turn(&out, Turn{Prompt: "again", Err: fmt.Errorf("boom")}))
+
+	assert.Equal(t, "octocat: "+
+		"assistant: Ahoy\n"+
+		"1. 1: Issue 1\n"+
+		"Sail?\n  Leave port now\nReply: [y/N]\n"+
+		"[warning] stream.missing-done: no done (stream)\n"+
+		"error: boom\n", out.String())
+}
+
+func TestJSONRenderer(t *testing.T) {
+	var out bytes.Buffer
+	r := &JSONRenderer{}
+	require.NoError(t, r.Prompt(&out, "octocat"))
+	require.NoError(t, r.Turn(&out, renderTurn))
+	require.NoError(t, r.Turn(&out, Turn{Prompt: "again", Err: fmt.Errorf("boom")}))
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var first jsonTurn
+	require.NoError(t, json.Unmarshal(lines[0], &first))
+	assert.Equal(t, "hello", first.Prompt)
+	assert.Empty(t, first.Error)
+	require.NotNil(t, first.Response)
+	assert.Equal(t, "Ahoy", first.Response.Messages[0].Content)
+	assert.Equal(t, renderTurn.Response.Violations, first.Response.Violations)
+
+	assert.JSONEq(t, `{"prompt": "again", "error": "boom"}`, string(lines[1]))
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	var out bytes.Buffer
+	r := &MarkdownRenderer{}
+	require.NoError(t, r.Prompt(&out, "octocat"))
+	require.NoError(t, r.Turn(&out, renderTurn))
+	require.NoError(t, r.Turn(&out, Turn{Username: "octocat", Prompt: "again", Err: fmt.Errorf("boom")}))
+
+	assert.Equal(t, "### octocat\n\nhello\n\n"+
+		"### assistant\n\nAhoy\n\n"+
+		"References:\n\n- [Issue 1](https://github.com/octo/repo/issues/1)\n\n"+
+		"### agent\n\n> **Sail?**\n> Leave port now\n\n"+
+		"Protocol violations:\n\n- `warning` stream.missing-done: no done (stream)\n\n"+
+		"### octocat\n\nagain\n\n> **Error:** boom\n\n", out.String())
+}
+
+func TestRenderer_Notice(t *testing.T) {
+	tests := []struct {
+		name     string
+		renderer Renderer
+		expected string
+	}{
+		{
+			name:     "pretty",
+			renderer: &PrettyRenderer{Colors: DefaultColors},
+			expected: "\nStart typing\n" + DefaultColors.infoColor("Choice 1 is now in the history\n") + DefaultColors.errorColor("Alas...No file to send\n"),
+		},
+		{
+			name:     "pretty_without_colors",
+			renderer: &PrettyRenderer{},
+			expected: "\nStart typing\nChoice 1 is now in the history\nAlas...No file to send\n",
+		},
+		{
+			name:     "plain",
+			renderer: &PlainRenderer{},
+			expected: "\nStart typing\nChoice 1 is now in the history\nerror: No file to send\n",
+		},
+		{
+			name:     "json",
+			renderer: &JSONRenderer{},
+			expected: `{"notice":"Choice 1 is now in the history","level":"info"}` + "\n" + `{"notice":"No file to send","level":"error"}` + "\n",
+		},
+		{
+			name:     "markdown",
+			renderer: &MarkdownRenderer{},
+			expected: "> Choice 1 is now in the history\n\n> **Error:** No file to send\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, tt.renderer.Notice(&out, Notice{Level: NoticeBanner, Text: "Start typing"}))
+			require.NoError(t, tt.renderer.Notice(&out, Notice{Level: NoticeInfo, Text: "Choice 1 is now in the history"}))
+			require.NoError(t, tt.renderer.Notice(&out, Notice{Level: NoticeError, Text: "No file to send"}))
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+}
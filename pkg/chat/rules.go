@@ -0,0 +1,253 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a rule violation is. Events with an error are not
+// emitted.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeverityOff     Severity = "off"
+)
+
+// Rule is a named agent protocol check.
+type Rule struct {
+	ID          string   `json:"id"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description"`
+}
+
+const (
+	RuleSSEUnsupportedField = "sse.unsupported-field"
+	RuleSSEMultilineData    = "sse.multiline-data"
+
+	RuleStreamEmpty         = "stream.empty"
+	RuleStreamMissingDone   = "stream.missing-done"
+	RuleStreamDuplicateDone = "stream.duplicate-done"
+	RuleStreamDataAfterDone = "stream.data-after-done"
+
+	RuleEventMultipleTypes   = "event.multiple-types"
+	RuleEventUnsupportedType = "event.unsupported-type"
+	RuleEventMissingType     = "event.missing-type"
+
+	RuleMessageInvalid               = "message.invalid"
+	RuleMessageConfirmationInPayload = "message.confirmation-in-payload"
+	RuleMessageErrorsInPayload       = "message.errors-in-payload"
+	RuleMessageReferencesInPayload   = "message.references-in-payload"
+	RuleMessageRoleChange            = "message.role-change"
+	RuleMessageInconsistentMetadata  = "message.inconsistent-metadata"
+	RuleMessageMissingFinishReason   = "message.missing-finish-reason"
+	RuleMessageMultipleChoices       = "message.multiple-choices"
+
+	RuleConfirmationInvalid        = "confirmation.invalid"
+	RuleConfirmationMissingType    = "confirmation.missing-type"
+	RuleConfirmationMissingTitle   = "confirmation.missing-title"
+	RuleConfirmationMissingMessage = "confirmation.missing-message"
+	RuleConfirmationBeforeText     = "confirmation.before-text"
+
+	RuleReferenceInvalid            = "reference.invalid"
+	RuleReferenceEmpty              = "reference.empty"
+	RuleReferenceMissingType        = "reference.missing-type"
+	RuleReferenceMissingID          = "reference.missing-id"
+	RuleReferenceMissingDisplayName = "reference.missing-display-name"
+	RuleReferenceUnknownType        = "reference.unknown-type"
+	RuleReferenceInvalidData        = "reference.invalid-data"
+	RuleReferenceInvalidDisplayURL  = "reference.invalid-display-url"
+	RuleReferenceInvalidDisplayIcon = "reference.invalid-display-icon"
+
+	RuleErrorInvalid           = "error.invalid"
+	RuleErrorEmpty             = "error.empty"
+	RuleErrorMissingType       = "error.missing-type"
+	RuleErrorMissingCode       = "error.missing-code"
+	RuleErrorMissingMessage    = "error.missing-message"
+	RuleErrorMissingIdentifier = "error.missing-identifier"
+	RuleErrorUnknownType       = "error.unknown-type"
+	RuleErrorDuplicateID       = "error.duplicate-identifier"
+	RuleErrorUnknownCode       = "error.unknown-code"
+)
+
+// registry holds every rule checked while parsing, by id.
+var registry = map[string]Rule{}
+
+func init() {
+	for _, r := range []Rule{
+		{RuleSSEUnsupportedField, SeverityWarning, "Copilot clients only read `event` and `data` fields"},
+		{RuleSSEMultilineData, SeverityWarning, "Copilot clients read every data line on its own, while the SSE spec joins them"},
+
+		{RuleStreamEmpty, SeverityWarning, "a response must have at least one event"},
+		{RuleStreamMissingDone, SeverityWarning, "a response must end with data: [DONE]"},
+		{RuleStreamDuplicateDone, SeverityWarning, "a response must send data: [DONE] only once"},
+		{RuleStreamDataAfterDone, SeverityWarning, "Copilot clients stop reading a response at data: [DONE]"},
+
+		{RuleEventMultipleTypes, SeverityError, "a response cannot have more than one copilot event type"},
+		{RuleEventUnsupportedType, SeverityWarning, "the event type is not one Copilot supports"},
+		{RuleEventMissingType, SeverityWarning, "an event field must have a type"},
+
+		{RuleMessageInvalid, SeverityError, "message data must be a chat completion chunk"},
+		{RuleMessageConfirmationInPayload, SeverityError, "confirmations must be sent as a copilot_confirmation event"},
+		{RuleMessageErrorsInPayload, SeverityError, "errors must be sent as a copilot_errors event"},
+		{RuleMessageReferencesInPayload, SeverityError, "references must be sent as a copilot_references event"},
+		{RuleMessageRoleChange, SeverityWarning, "the role of a message must not change before it finishes"},
+		{RuleMessageInconsistentMetadata, SeverityWarning, "every chunk of a response must have the same id, model and created values"},
+		{RuleMessageMissingFinishReason, SeverityWarning, "every message must end with a chunk setting a finish_reason"},
+		{RuleMessageMultipleChoices, SeverityWarning, "Copilot clients ignore every completion choice but the first"},
+
+		{RuleConfirmationInvalid, SeverityError, "copilot_confirmation data must be a confirmation object"},
+		{RuleConfirmationMissingType, SeverityError, "confirmations must have a type"},
+		{RuleConfirmationMissingTitle, SeverityError, "confirmations must have a title"},
+		{RuleConfirmationMissingMessage, SeverityError, "confirmations must have a message"},
+		{RuleConfirmationBeforeText, SeverityWarning, "a confirmation must follow the message content explaining it"},
+
+		{RuleReferenceInvalid, SeverityError, "copilot_references data must be an array of references"},
+		{RuleReferenceEmpty, SeverityError, "copilot_references must have at least one reference"},
+		{RuleReferenceMissingType, SeverityError, "references must have a type"},
+		{RuleReferenceMissingID, SeverityError, "references must have an id"},
+		{RuleReferenceMissingDisplayName, SeverityError, "references must have a metadata display name"},
+		{RuleReferenceUnknownType, SeverityWarning, "the reference type is neither well-known nor registered from a schema file"},
+		{RuleReferenceInvalidData, SeverityWarning, "reference data must match the schema of its type"},
+		{RuleReferenceInvalidDisplayURL, SeverityWarning, "a metadata display url must be an absolute http or https url"},
+		{RuleReferenceInvalidDisplayIcon, SeverityWarning, "a metadata display icon must be an absolute http or https url or an inline image"},
+
+		{RuleErrorInvalid, SeverityError, "copilot_errors data must be an array of errors"},
+		{RuleErrorEmpty, SeverityError, "copilot_errors must have at least one error"},
+		{RuleErrorMissingType, SeverityError, "errors must have a type"},
+		{RuleErrorMissingCode, SeverityError, "errors must have a code"},
+		{RuleErrorMissingMessage, SeverityError, "errors must have a message"},
+		{RuleErrorMissingIdentifier, SeverityError, "errors must have an identifier"},
+		{RuleErrorUnknownType, SeverityWarning, "the error type must be one Copilot clients handle: `reference`, `function` or `agent`"},
+		{RuleErrorDuplicateID, SeverityWarning, "error identifiers must be unique within a response"},
+		{RuleErrorUnknownCode, SeverityWarning, "error codes must be in the error code catalog of the rules file, when it has one"},
+	} {
+		registry[r.ID] = r
+	}
+}
+
+// Rules returns every registered rule, sorted by id.
+func Rules() []Rule {
+	rules := make([]Rule, 0, len(registry))
+	for _, r := range registry {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// Violation is a rule broken by an agent response.
+type Violation struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+
+	// Event is the 1-based index of the SSE event breaking the rule, or 0 when
+	// the rule is broken by the stream as a whole. Offset is the byte offset
+	// the event starts at, and is left zero for the stream as a whole.
+	Event  int   `json:"event,omitempty"`
+	Offset int64 `json:"offset"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s: %s", v.Severity, v.Rule, v.Message)
+}
+
+// Location describes where in the stream the rule was broken.
+func (v Violation) Location() string {
+	if v.Event == 0 {
+		return "stream"
+	}
+	return fmt.Sprintf("event %d at byte %d", v.Event, v.Offset)
+}
+
+// RuleSet configures the severity of the rules, e.g. to turn a rule off for a
+// project, and the custom reference types the project uses.
+type RuleSet struct {
+	overrides      map[string]Severity
+	referenceTypes map[string]*Schema
+	errorCodes     map[string]bool
+}
+
+// ruleConfig is the format of a rules file.
+type ruleConfig struct {
+	Rules      map[string]Severity `json:"rules"`
+	ErrorCodes []string            `json:"error_codes"`
+}
+
+// NewRuleSet creates a RuleSet with the default severity of every rule and
+// only the well-known reference types.
+func NewRuleSet() *RuleSet {
+	return &RuleSet{
+		overrides:      map[string]Severity{},
+		referenceTypes: map[string]*Schema{},
+		errorCodes:     map[string]bool{},
+	}
+}
+
+// LoadRuleSet reads a JSON rules file of the form
+// {"rules": {"reference.missing-display-name": "off", "event.multiple-types": "warning"}, "error_codes": ["rate_limited"]}.
+func LoadRuleSet(path string) (*RuleSet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+
+	var config ruleConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("error parsing rules: %w", err)
+	}
+
+	rs := NewRuleSet()
+	for id, severity := range config.Rules {
+		if err := rs.Set(id, severity); err != nil {
+			return nil, err
+		}
+	}
+	rs.RegisterErrorCodes(config.ErrorCodes...)
+	return rs, nil
+}
+
+// Set overrides the severity of a rule.
+func (rs *RuleSet) Set(id string, severity Severity) error {
+	if _, ok := registry[id]; !ok {
+		return fmt.Errorf("unknown rule: %s", id)
+	}
+
+	severity = Severity(strings.ToLower(string(severity)))
+	switch severity {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+	default:
+		return fmt.Errorf("rule %s: severity must be either `error`, `warning`, `info`, or `off`", id)
+	}
+
+	rs.overrides[id] = severity
+	return nil
+}
+
+// Severity returns the configured severity of a rule.
+func (rs *RuleSet) Severity(id string) Severity {
+	if severity, ok := rs.overrides[id]; ok {
+		return severity
+	}
+	return registry[id].Severity
+}
+
+// RegisterErrorCodes adds codes to the catalog of error codes the agent may
+// send. Codes are only checked once the catalog has any.
+func (rs *RuleSet) RegisterErrorCodes(codes ...string) {
+	for _, code := range codes {
+		rs.errorCodes[code] = true
+	}
+}
+
+// knownErrorCode reports whether a code is in the catalog, or there is no
+// catalog to check against.
+func (rs *RuleSet) knownErrorCode(code string) bool {
+	return len(rs.errorCodes) == 0 || rs.errorCodes[code]
+}
@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRuleSet(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		expected      map[string]Severity
+		knownCodes    []string
+		expectedError string
+	}{
+		{
+			name:   "overrides",
+			config: `{"rules": {"reference.missing-display-name": "off", "event.multiple-types": "WARNING"}, "error_codes": ["rate_limited"]}`,
+			expected: map[string]Severity{
+				RuleReferenceMissingDisplayName: SeverityOff,
+				RuleEventMultipleTypes:          SeverityWarning,
+				RuleMessageInvalid:              SeverityError,
+			},
+			knownCodes: []string{"rate_limited"},
+		},
+		{
+			name:          "unknown_rule",
+			config:        `{"rules": {"reference.missing-name": "off"}}`,
+			expectedError: "unknown rule: reference.missing-name",
+		},
+		{
+			name:          "unknown_severity",
+			config:        `{"rules": {"reference.missing-display-name": "fatal"}}`,
+			expectedError: "rule reference.missing-display-name: severity must be either `error`, `warning`, `info`, or `off`",
+		},
+		{
+			name:          "invalid_json",
+			config:        `rules`,
+			expectedError: "error parsing rules",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.config), 0o600))
+
+			rules, err := LoadRuleSet(path)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			for id, severity := range tt.expected {
+				assert.Equal(t, severity, rules.Severity(id), id)
+			}
+			for _, code := range tt.knownCodes {
+				assert.True(t, rules.knownErrorCode(code), code)
+			}
+			if len(tt.knownCodes) > 0 {
+				assert.False(t, rules.knownErrorCode("teapot"))
+			}
+		})
+	}
+}
+
+func TestRuleSet_LoadReferenceTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "references.json")
+	config := `{"types": {"acme.ticket": {"type": "object", "required": ["key"], "properties": {"key": {"type": "string"}}}}}`
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	rules := NewRuleSet()
+	require.NoError(t, rules.LoadReferenceTypes(path))
+
+	schema, ok := rules.referenceSchema("acme.ticket")
+	require.True(t, ok)
+	assert.Equal(t, []string{"key"}, schema.Required)
+
+	_, ok = rules.referenceSchema("github.issue")
+	assert.True(t, ok)
+
+	_, ok = rules.referenceSchema("acme.parrot")
+	assert.False(t, ok)
+}
+
+func TestViolation_Location(t *testing.T) {
+	tests := []struct {
+		name      string
+		violation Violation
+		expected  string
+	}{
+		{name: "event", violation: Violation{Event: 2, Offset: 127}, expected: "event 2 at byte 127"},
+		{name: "first_event", violation: Violation{Event: 1}, expected: "event 1 at byte 0"},
+		{name: "stream", violation: Violation{}, expected: "stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.violation.Location())
+		})
+	}
+}
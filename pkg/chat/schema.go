@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema used to check the data of references:
+// types, object properties, required properties, array items, enums and the
+// `uri` format.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Format      string             `json:"format,omitempty"`
+}
+
+// Validate checks a value decoded from JSON against the schema, and returns
+// every problem found, prefixed by the path to the offending value.
+func (s *Schema) Validate(path string, v any) []string {
+	if s == nil {
+		return nil
+	}
+
+	var problems []string
+	if s.Type != "" && !schemaTypeMatches(s.Type, v) {
+		return append(problems, fmt.Sprintf("%s: expected %s, found %s", path, s.Type, schemaTypeOf(v)))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			// enums may hold objects and arrays, which cannot be compared with ==
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", path, v, s.Enum))
+		}
+	}
+
+	if s.Format == "uri" {
+		if str, ok := v.(string); ok && !isAbsoluteURL(str) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not an absolute url", path, str))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+
+		// sort the properties so problems are reported in a stable order
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if value, ok := v[name]; ok {
+				problems = append(problems, s.Properties[name].Validate(path+"."+name, value)...)
+			}
+		}
+
+	case []any:
+		for i, item := range v {
+			problems = append(problems, s.Items.Validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+	}
+
+	return problems
+}
+
+func schemaTypeMatches(t string, v any) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return schemaTypeOf(v) == t
+	}
+}
+
+func schemaTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// isAbsoluteURL reports whether s is an absolute http or https url.
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	tests := []struct {
+		name             string
+		schema           string
+		value            string
+		expectedProblems []string
+	}{
+		{
+			name:   "happy_path",
+			schema: `{"type": "object", "required": ["key"], "properties": {"key": {"type": "string"}, "url": {"type": "string", "format": "uri"}}}`,
+			value:  `{"key": "ACME-42", "url": "https://acme.example/ACME-42"}`,
+		},
+		{
+			name:   "invalid_properties",
+			schema: `{"type": "object", "required": ["key"], "properties": {"count": {"type": "integer"}, "url": {"type": "string", "format": "uri"}}}`,
+			value:  `{"count": 1.5, "url": "acme"}`,
+			expectedProblems: []string{
+				`data: missing required property "key"`,
+				`data.count: expected integer, found number`,
+				`data.url: "acme" is not an absolute url`,
+			},
+		},
+		{
+			name:   "scalar_enum",
+			schema: `{"type": "string", "enum": ["open", "closed"]}`,
+			value:  `"merged"`,
+			expectedProblems: []string{
+				`data: merged is not one of [open closed]`,
+			},
+		},
+		{
+			name:   "object_enum",
+			schema: `{"enum": [{"line": 1}, ["a", "b"], "none"]}`,
+			value:  `{"line": 1}`,
+		},
+		{
+			name:   "array_enum",
+			schema: `{"enum": [{"line": 1}, ["a", "b"], "none"]}`,
+			value:  `["a", "b"]`,
+		},
+		{
+			name:   "non_scalar_enum_mismatch",
+			schema: `{"enum": [{"line": 1}, ["a", "b"]]}`,
+			value:  `{"line": 2}`,
+			expectedProblems: []string{
+				`data: map[line:2] is not one of [map[line:1] [a b]]`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema Schema
+			require.NoError(t, json.Unmarshal([]byte(tt.schema), &schema))
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tt.value), &value))
+
+			assert.Equal(t, tt.expectedProblems, schema.Validate("data", value))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Signer signs the requests sent to an agent.
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// KeySigner signs requests with an ECDSA private key the same way GitHub signs
+// the payloads it sends to agents.
+type KeySigner struct {
+	key        *ecdsa.PrivateKey
+	publicKey  []byte
+	identifier string
+}
+
+// NewKeySigner creates a KeySigner from a PEM encoded ECDSA private key. The
+// key identifier is the hex encoded SHA-256 of its public key.
+func NewKeySigner(privateKey []byte) (*KeySigner, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+
+	var key *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		k, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing private key: %w", err)
+		}
+		key = k
+	default:
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing private key: %w", err)
+		}
+		ecKey, ok := k.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key must be an ECDSA key, found %T", k)
+		}
+		key = ecKey
+	}
+
+	return newKeySigner(key)
+}
+
+// GenerateKeySigner creates a KeySigner with a new P-256 private key, e.g. to
+// sign the requests sent to an agent under test.
+func GenerateKeySigner() (*KeySigner, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating private key: %w", err)
+	}
+	return newKeySigner(key)
+}
+
+func newKeySigner(key *ecdsa.PrivateKey) (*KeySigner, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+
+	return &KeySigner{key: key, publicKey: der, identifier: hex.EncodeToString(sum[:])}, nil
+}
+
+// LoadKeySigner creates a KeySigner from either a PEM encoded private key or
+// the path to a file holding one.
+func LoadKeySigner(privateKey string) (*KeySigner, error) {
+	if strings.Contains(privateKey, "-----BEGIN") {
+		return NewKeySigner([]byte(privateKey))
+	}
+
+	b, err := os.ReadFile(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key: %w", err)
+	}
+	return NewKeySigner(b)
+}
+
+// Identifier is sent in the Github-Public-Key-Identifier header.
+func (s *KeySigner) Identifier() string {
+	return s.identifier
+}
+
+// PublicKey returns the PEM encoded public key the signatures are verified
+// with, in the format GitHub publishes its own keys in.
+func (s *KeySigner) PublicKey() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: s.publicKey}))
+}
+
+func (s *KeySigner) Sign(req *http.Request, body []byte) error {
+	digest := sha256.Sum256(body)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return fmt.Errorf("error signing request: %w", err)
+	}
+
+	req.Header.Set("Github-Public-Key-Signature", base64.StdEncoding.EncodeToString(sig))
+	req.Header.Set("Github-Public-Key-Identifier", s.identifier)
+	return nil
+}
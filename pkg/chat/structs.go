@@ -1,26 +1,53 @@
 package chat
 
-type Output struct {
-	Message  *Message `json:"message"`
-	LogLevel string   `json:"log_level"`
-}
-
 type Message struct {
 	Role         string                   `json:"role"`
 	Content      string                   `json:"content"`
 	Name         string                   `json:"name,omitempty"`
 	FunctionCall *ChatMessageFunctionCall `json:"function_call,omitempty"`
+	ToolCalls    []ToolCall               `json:"tool_calls,omitempty"`
 	Confirmation *Confirmation            `json:"copilot_confirmation"`
 	References   []Reference              `json:"copilot_references"`
 	Errors       []CopilotError           `json:"copilot_errors"`
+
+	// Metadata is aggregated from the chunks the message was streamed in. It
+	// is never sent to the agent.
+	Metadata *MessageMetadata `json:"metadata,omitempty"`
+}
+
+// MessageMetadata describes how a message was streamed, e.g. whether it was
+// cut short by its length or content filtering.
+type MessageMetadata struct {
+	Index             int    `json:"index"`
+	ID                string `json:"id,omitempty"`
+	Model             string `json:"model,omitempty"`
+	Created           int64  `json:"created,omitempty"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	FinishReason      string `json:"finish_reason,omitempty"`
+	Chunks            int    `json:"chunks"`
+	Usage             *Usage `json:"usage,omitempty"`
+}
+
+// Usage is the number of tokens used to generate a response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 type Completion struct {
-	Choices []CompletionChoice `json:"choices"`
+	ID                string             `json:"id,omitempty"`
+	Created           int64              `json:"created,omitempty"`
+	Model             string             `json:"model,omitempty"`
+	SystemFingerprint string             `json:"system_fingerprint,omitempty"`
+	Choices           []CompletionChoice `json:"choices"`
+	Usage             *Usage             `json:"usage,omitempty"`
 }
 
 type CompletionChoice struct {
-	Delta Message `json:"delta"`
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason string  `json:"finish_reason,omitempty"`
 }
 
 type Request struct {
@@ -34,6 +61,13 @@ type ChatMessageFunctionCall struct {
 	Arguments string `json:"arguments"`
 }
 
+type ToolCall struct {
+	Index    int                     `json:"index"`
+	ID       string                  `json:"id,omitempty"`
+	Type     string                  `json:"type,omitempty"`
+	Function ChatMessageFunctionCall `json:"function"`
+}
+
 type Confirmation struct {
 	Type         string `json:"type"`
 	Title        string `json:"title"`
@@ -54,6 +88,15 @@ type ReferenceMetadata struct {
 	DisplayURL  string `json:"display_url"`
 }
 
+// The error types Copilot clients handle. Reference and function errors
+// concern a single reference or function call, while agent errors fail the
+// whole response.
+const (
+	ErrorTypeReference = "reference"
+	ErrorTypeFunction  = "function"
+	ErrorTypeAgent     = "agent"
+)
+
 type CopilotError struct {
 	Type       string `json:"type"`
 	Code       string `json:"code"`
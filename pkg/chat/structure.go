@@ -0,0 +1,142 @@
+package chat
+
+import "sort"
+
+const doneData = "[DONE]"
+
+// streamState tracks what a stream has sent so far, to check its structure
+// across events.
+type streamState struct {
+	events   int
+	dones    int
+	sawText  bool
+	id       string
+	model    string
+	created  int64
+	mismatch map[string]bool
+	choices  bool
+
+	// roles holds the role of the message being streamed by every choice, and
+	// finished whether the choice has set a finish_reason.
+	roles    map[int]string
+	finished map[int]bool
+}
+
+func newStreamState() streamState {
+	return streamState{
+		mismatch: map[string]bool{},
+		roles:    map[int]string{},
+		finished: map[int]bool{},
+	}
+}
+
+// checkDone records a [DONE] payload.
+func (p *Parser) checkDone() {
+	p.stream.dones++
+	if p.stream.dones > 1 {
+		p.report(RuleStreamDuplicateDone, "found [DONE] %d times", p.stream.dones)
+	}
+}
+
+// checkAfterDone reports payloads sent after [DONE], which Copilot clients
+// never read.
+func (p *Parser) checkAfterDone(datas []string) {
+	if p.stream.dones == 0 {
+		return
+	}
+	for _, d := range datas {
+		if d != "" && d != doneData {
+			p.report(RuleStreamDataAfterDone, "found data after [DONE]: %s", d)
+			return
+		}
+	}
+}
+
+// checkConfirmation reports confirmations sent before the text explaining
+// what is being confirmed.
+func (p *Parser) checkConfirmation() {
+	if !p.stream.sawText {
+		p.report(RuleConfirmationBeforeText, "confirmation sent before any message content")
+	}
+}
+
+// checkCompletion checks a chunk against the chunks before it.
+func (p *Parser) checkCompletion(c Completion) {
+	s := &p.stream
+	p.checkMetadata("id", c.ID != "" && s.id != "" && c.ID != s.id, s.id, c.ID)
+	p.checkMetadata("model", c.Model != "" && s.model != "" && c.Model != s.model, s.model, c.Model)
+	p.checkMetadata("created", c.Created != 0 && s.created != 0 && c.Created != s.created, s.created, c.Created)
+	if s.id == "" {
+		s.id = c.ID
+	}
+	if s.model == "" {
+		s.model = c.Model
+	}
+	if s.created == 0 {
+		s.created = c.Created
+	}
+
+	for _, choice := range c.Choices {
+		if choice.Index != 0 && !s.choices {
+			s.choices = true
+			p.report(RuleMessageMultipleChoices, "found choice %d, Copilot clients only display choice 0", choice.Index)
+		}
+
+		if choice.Delta.Content != "" {
+			s.sawText = true
+		}
+
+		role := choice.Delta.Role
+		if s.finished[choice.Index] {
+			// a finished choice may start a new message
+			delete(s.roles, choice.Index)
+			s.finished[choice.Index] = false
+		}
+		if previous := s.roles[choice.Index]; role != "" && previous != "" && role != previous {
+			p.report(RuleMessageRoleChange, "choice %d changed role from %s to %s before finishing its message", choice.Index, previous, role)
+		}
+		if role != "" {
+			s.roles[choice.Index] = role
+		} else if _, ok := s.roles[choice.Index]; !ok {
+			s.roles[choice.Index] = ""
+		}
+
+		if choice.FinishReason != "" {
+			s.finished[choice.Index] = true
+		}
+	}
+}
+
+// checkMetadata reports a chunk whose metadata field differs from the
+// earlier chunks, once per field.
+func (p *Parser) checkMetadata(field string, differs bool, previous any, current any) {
+	if !differs || p.stream.mismatch[field] {
+		return
+	}
+	p.stream.mismatch[field] = true
+	p.report(RuleMessageInconsistentMetadata, "chunks have different %s values: %v and %v", field, previous, current)
+}
+
+// checkStreamEnd checks the structure of the stream once it has been read.
+func (p *Parser) checkStreamEnd() {
+	s := &p.stream
+	if s.events == 0 {
+		p.report(RuleStreamEmpty, "the response has no events")
+		return
+	}
+
+	if s.dones == 0 {
+		p.report(RuleStreamMissingDone, "the response did not end with data: [DONE]")
+	}
+
+	indexes := make([]int, 0, len(s.roles))
+	for i := range s.roles {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		if !s.finished[i] {
+			p.report(RuleMessageMissingFinishReason, "choice %d never set a finish_reason", i)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package chat
+
+import "os"
+
+// notifyResize does nothing, since the platform does not signal that the
+// terminal was resized.
+func notifyResize(c chan<- os.Signal) {}
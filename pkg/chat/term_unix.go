@@ -0,0 +1,14 @@
+//go:build unix
+
+package chat
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize sends on c whenever the terminal is resized.
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
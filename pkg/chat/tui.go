@@ -0,0 +1,578 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// RunTUI runs a chat session full screen, with the conversation on the left
+// and the timeline of every SSE event of the selected turn on the right. In
+// and Out must be a terminal.
+func RunTUI(opts Options) error {
+	if opts.URL == "" {
+		return fmt.Errorf("agent url is required")
+	}
+	in, ok := opts.In.(*os.File)
+	if opts.In == nil {
+		in, ok = os.Stdin, true
+	}
+	out, ok2 := opts.Out.(*os.File)
+	if opts.Out == nil {
+		out, ok2 = os.Stdout, true
+	}
+	if !ok || !ok2 || !isTerminal(in) || !isTerminal(out) {
+		return fmt.Errorf("the full-screen mode needs a terminal")
+	}
+
+	redactor, err := sessionRedactor(opts)
+	if err != nil {
+		return err
+	}
+
+	// the timeline shows what the logs would, and logs would break the layout
+	client, err := newClient(opts, io.Discard, redactor)
+	if err != nil {
+		return err
+	}
+
+	width, height, err := term.GetSize(int(out.Fd()))
+	if err != nil {
+		return fmt.Errorf("error reading the terminal size: %w", err)
+	}
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("error setting up the terminal: %w", err)
+	}
+	defer term.Restore(int(in.Fd()), state)
+
+	fmt.Fprint(out, "\x1b[?1049h")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan tuiKey)
+	go func() {
+		defer close(keys)
+		r := bufio.NewReader(in)
+		for {
+			k, err := readKey(r)
+			if err != nil {
+				return
+			}
+			keys <- k
+		}
+	}()
+
+	resizes := make(chan os.Signal, 1)
+	notifyResize(resizes)
+
+	type result struct {
+		turn *tuiTurn
+		resp *Response
+		err  error
+	}
+	// buffered so a turn in flight when the session ends does not block
+	results := make(chan result, 1)
+
+	m := &tuiModel{username: opts.Username, width: width, height: height, redactor: redactor, colors: opts.Colors}
+	var conversation Conversation
+	var cancel context.CancelFunc
+	defer func() {
+		if cancel != nil {
+			cancel()
+		}
+	}()
+
+	for {
+		if _, err := io.WriteString(out, m.view()); err != nil {
+			return fmt.Errorf("error writing to stdout: %w", err)
+		}
+
+		select {
+		case <-resizes:
+			if w, h, err := term.GetSize(int(out.Fd())); err == nil {
+				m.width, m.height = w, h
+			}
+
+		case res := <-results:
+			cancel()
+			cancel = nil
+			res.turn.pending = false
+			res.turn.resp, res.turn.err = res.resp, res.err
+			if res.err != nil {
+				// drop the failed turn from the history and let the user try again
+				conversation.DropLast()
+			} else {
+				conversation.AddResponse(res.resp)
+			}
+
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+
+			action, line := m.handleKey(k)
+			switch action {
+			case tuiQuit:
+				return nil
+
+			case tuiInterrupt:
+				if cancel == nil {
+					return nil
+				}
+				cancel()
+
+			case tuiSend:
+				if cancel != nil {
+					m.status = "Wait for the agent to respond, or press Ctrl+C to cancel the turn"
+					m.input = []rune(line)
+					continue
+				}
+
+				if choice, ok := parseChoiceCommand(line); ok {
+					if !conversation.PickChoice(choice) {
+						m.status = fmt.Sprintf("The last response has no such choice, usage: %s N", choiceCommand)
+					} else {
+						m.status = fmt.Sprintf("Choice %d is now in the history", choice)
+					}
+					continue
+				}
+
+				conversation.AddUser(line)
+				turn := m.addTurn(line)
+
+				var ctx context.Context
+				ctx, cancel = turnContext(opts.Timeout)
+				sent := append([]Message(nil), conversation.Messages()...)
+				go func() {
+					resp, err := client.Send(ctx, sent)
+					results <- result{turn: turn, resp: resp, err: err}
+				}()
+			}
+		}
+	}
+}
+
+// turnContext bounds a turn by timeout, when it is not zero.
+func turnContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// tuiTurn is a turn of a full-screen session.
+type tuiTurn struct {
+	prompt  string
+	started time.Time
+	pending bool
+	resp    *Response
+	err     error
+}
+
+type tuiPane int
+
+const (
+	paneConversation tuiPane = iota
+	paneTimeline
+)
+
+type tuiAction int
+
+const (
+	tuiNone tuiAction = iota
+	tuiSend
+	tuiInterrupt
+	tuiQuit
+)
+
+// tuiLine is a line of a pane, colored with an escape code when color is set.
+type tuiLine struct {
+	text  string
+	color string
+}
+
+// tuiModel is what the full-screen mode displays.
+type tuiModel struct {
+	username string
+	turns    []*tuiTurn
+	selected int
+	focus    tuiPane
+
+	// convScroll is how many lines the conversation is scrolled up from its
+	// end, and timelineScroll how many lines the timeline is scrolled down
+	// from its start.
+	convScroll     int
+	timelineScroll int
+
+	input  []rune
+	status string
+	width  int
+	height int
+
+	// redactor masks the secrets in the panes.
+	redactor *Redactor
+
+	colors Colors
+}
+
+func (m *tuiModel) addTurn(prompt string) *tuiTurn {
+	turn := &tuiTurn{prompt: prompt, started: time.Now(), pending: true}
+	m.turns = append(m.turns, turn)
+	m.selected = len(m.turns) - 1
+	m.convScroll = 0
+	m.timelineScroll = 0
+	return turn
+}
+
+// paneHeight is the number of lines of each pane, below the header and above
+// the status and input lines.
+func (m *tuiModel) paneHeight() int {
+	return max(m.height-3, 1)
+}
+
+// handleKey updates the model for a key, returning the line to send with
+// tuiSend.
+func (m *tuiModel) handleKey(k tuiKey) (tuiAction, string) {
+	m.status = ""
+	page := m.paneHeight()
+
+	switch k.code {
+	case keyRune:
+		m.input = append(m.input, k.r)
+	case keyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case keyCtrlU:
+		m.input = nil
+	case keyEnter:
+		line := strings.TrimSpace(string(m.input))
+		if line == "" {
+			return tuiNone, ""
+		}
+		m.input = nil
+		return tuiSend, line
+	case keyTab:
+		if m.focus == paneConversation {
+			m.focus = paneTimeline
+		} else {
+			m.focus = paneConversation
+		}
+	case keyUp:
+		m.scroll(-1)
+	case keyDown:
+		m.scroll(1)
+	case keyPageUp:
+		m.scroll(-page)
+	case keyPageDown:
+		m.scroll(page)
+	case keyHome:
+		m.scroll(-1 << 20)
+	case keyEnd:
+		m.scroll(1 << 20)
+	case keyCtrlP:
+		if m.selected > 0 {
+			m.selected--
+			m.timelineScroll = 0
+		}
+	case keyCtrlN:
+		if m.selected < len(m.turns)-1 {
+			m.selected++
+			m.timelineScroll = 0
+		}
+	case keyCtrlC:
+		return tuiInterrupt, ""
+	case keyCtrlD:
+		return tuiQuit, ""
+	}
+	return tuiNone, ""
+}
+
+// scroll moves the focused pane by n lines, down when n is positive. The
+// offsets are clamped when the panes are drawn.
+func (m *tuiModel) scroll(n int) {
+	if m.focus == paneConversation {
+		m.convScroll = max(m.convScroll-n, 0)
+	} else {
+		m.timelineScroll = max(m.timelineScroll+n, 0)
+	}
+}
+
+// view draws the whole screen.
+func (m *tuiModel) view() string {
+	if m.width < 20 || m.height < 5 {
+		return "\x1b[H\x1b[2JThe terminal is too small"
+	}
+
+	leftWidth := (m.width - 1) / 2
+	rightWidth := m.width - leftWidth - 1
+	height := m.paneHeight()
+
+	left := m.conversationLines(leftWidth)
+	m.convScroll = min(m.convScroll, max(len(left)-height, 0))
+	end := len(left) - m.convScroll
+	left = left[max(end-height, 0):end]
+
+	right := m.timelineLines(rightWidth)
+	m.timelineScroll = min(m.timelineScroll, max(len(right)-height, 0))
+	right = right[m.timelineScroll:min(m.timelineScroll+height, len(right))]
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[?25l\x1b[H")
+
+	leftTitle, rightTitle := " Conversation", " Events"
+	if len(m.turns) > 0 {
+		rightTitle = fmt.Sprintf(" Events of turn %d of %d", m.selected+1, len(m.turns))
+	}
+	if m.focus == paneConversation {
+		leftTitle += " ◂"
+	} else {
+		rightTitle += " ◂"
+	}
+	screen.WriteString(m.colors.bold(fitLine(leftTitle, leftWidth) + "│" + fitLine(rightTitle, rightWidth)))
+
+	for i := 0; i < height; i++ {
+		screen.WriteString(fmt.Sprintf("\x1b[%d;1H", i+2))
+		screen.WriteString(paneRow(left, i, leftWidth, m.colors))
+		screen.WriteString("│")
+		screen.WriteString(paneRow(right, i, rightWidth, m.colors))
+	}
+
+	status := m.status
+	if status == "" {
+		status = "Enter send · Tab switch pane · ↑↓ PgUp PgDn scroll · Ctrl+P/Ctrl+N pick turn · Ctrl+C cancel or quit"
+	}
+	screen.WriteString(fmt.Sprintf("\x1b[%d;1H", m.height-1))
+	screen.WriteString(m.colors.infoColor(fitLine(status, m.width)))
+
+	// the input keeps its end in view
+	prompt := m.username + ": "
+	input := string(m.input)
+	for runewidth.StringWidth(prompt+input) > m.width-1 && input != "" {
+		_, size := utf8.DecodeRuneInString(input)
+		input = input[size:]
+	}
+	screen.WriteString(fmt.Sprintf("\x1b[%d;1H", m.height))
+	screen.WriteString(m.colors.userColor(m.username) + ": " + fitLine(input, m.width-runewidth.StringWidth(prompt)))
+	screen.WriteString(fmt.Sprintf("\x1b[%d;%dH\x1b[?25h", m.height, runewidth.StringWidth(prompt+input)+1))
+	return screen.String()
+}
+
+func paneRow(lines []tuiLine, i int, width int, c Colors) string {
+	if i >= len(lines) {
+		return strings.Repeat(" ", width)
+	}
+	text := fitLine(lines[i].text, width)
+	if lines[i].color != "" {
+		return c.Colorize(lines[i].color, text)
+	}
+	return text
+}
+
+// conversationLines lays out every turn of the conversation, marking the
+// selected one.
+func (m *tuiModel) conversationLines(width int) []tuiLine {
+	var lines []tuiLine
+	add := func(color string, indent string, text string) {
+		for _, l := range wrapText(m.redactor.String(text), width-runewidth.StringWidth(indent)) {
+			lines = append(lines, tuiLine{text: indent + l, color: color})
+		}
+	}
+
+	if len(m.turns) == 0 {
+		add(m.colors.Theme.Info, " ", "Start typing to chat with your assistant...")
+		return lines
+	}
+
+	for i, turn := range m.turns {
+		marker := "  "
+		if i == m.selected {
+			marker = "▶ "
+		}
+		add(m.colors.Theme.User, marker, fmt.Sprintf("%s: %s", m.username, turn.prompt))
+
+		switch {
+		case turn.pending:
+			add(m.colors.Theme.Info, "  ", "waiting for the agent...")
+		case turn.err != nil:
+			add(m.colors.Theme.Error, "  ", errorDetails(turn.err))
+		}
+
+		if resp := turn.resp; resp != nil {
+			choices := responseChoices(resp)
+			for _, choice := range choices {
+				if len(choices) > 1 {
+					add(m.colors.Theme.Warning, "  ", fmt.Sprintf("--- Choice %d ---", choice))
+				}
+				for _, msg := range resp.Messages {
+					if msg.Choice() == choice {
+						m.messageLines(msg, add)
+					}
+				}
+			}
+
+			color := m.colors.Theme.Debug
+			if len(resp.Violations) > 0 {
+				color = m.colors.Theme.Warning
+			}
+			add(color, "  ", fmt.Sprintf("%d events, %d violations", len(resp.Timeline), len(resp.Violations)))
+		}
+		lines = append(lines, tuiLine{})
+	}
+	return lines
+}
+
+func (m *tuiModel) messageLines(msg *Message, add func(color string, indent string, text string)) {
+	if msg.Content != "" {
+		role := msg.Role
+		if role == "" {
+			role = "agent"
+		}
+		add(m.colors.Theme.Role, "  ", role+":")
+		add("", "  ", msg.Content)
+	}
+	if msg.FunctionCall != nil {
+		add(m.colors.Theme.Info, "  ", fmt.Sprintf("function call: %s(%s)", msg.FunctionCall.Name, msg.FunctionCall.Arguments))
+	}
+	for _, call := range msg.ToolCalls {
+		add(m.colors.Theme.Info, "  ", fmt.Sprintf("tool call: %s(%s)", call.Function.Name, call.Function.Arguments))
+	}
+	if msg.Confirmation != nil {
+		add(m.colors.Theme.Info, "  ", fmt.Sprintf("%s: %s [y/N]", msg.Confirmation.Title, msg.Confirmation.Message))
+	}
+	if len(msg.References) > 0 {
+		names := make([]string, len(msg.References))
+		for i, reference := range msg.References {
+			names[i] = reference.Metadata.DisplayName
+		}
+		add(m.colors.Theme.Info, "  ", fmt.Sprintf("references: %s", strings.Join(names, ", ")))
+	}
+	for _, e := range msg.Errors {
+		add(m.colors.Theme.Error, "  ", fmt.Sprintf("%s error on %s: %s (%s)", e.Type, e.Identifier, e.Message, e.Code))
+	}
+}
+
+// timelineLines lays out the SSE events of the selected turn: when each was
+// received, its raw data, what it was parsed into, and the rules it broke.
+func (m *tuiModel) timelineLines(width int) []tuiLine {
+	var lines []tuiLine
+	add := func(color string, indent string, text string) {
+		for _, l := range wrapText(m.redactor.String(text), width-runewidth.StringWidth(indent)) {
+			lines = append(lines, tuiLine{text: indent + l, color: color})
+		}
+	}
+
+	if len(m.turns) == 0 {
+		add(m.colors.Theme.Info, " ", "Send a message to see the SSE events of its response here.")
+		return lines
+	}
+
+	turn := m.turns[m.selected]
+	if turn.pending {
+		add(m.colors.Theme.Info, " ", "Waiting for the agent...")
+		return lines
+	}
+	if turn.resp == nil {
+		add(m.colors.Theme.Error, " ", "The turn failed before any event was parsed:")
+		add(m.colors.Theme.Error, " ", errorDetails(turn.err))
+		return lines
+	}
+
+	resp := turn.resp
+	add("", " ", fmt.Sprintf("%d events in %s", len(resp.Timeline), resp.Metrics.Duration.Round(time.Millisecond)))
+	for _, e := range resp.Timeline {
+		lines = append(lines, tuiLine{})
+		add(m.colors.Theme.Info, " ", fmt.Sprintf("#%d  %s  +%s", e.Index, e.Received.Format("15:04:05.000"), e.Received.Sub(turn.started).Round(time.Millisecond)))
+
+		add("", " ", "raw:")
+		add("", "   ", strings.TrimRight(e.Raw, "\n"))
+
+		if len(e.Parsed) == 0 {
+			add("", " ", "parsed: nothing")
+		} else {
+			parsed, err := json.Marshal(e.Parsed)
+			if err != nil {
+				parsed = []byte(err.Error())
+			}
+			add("", " ", "parsed:")
+			add("", "   ", string(parsed))
+		}
+
+		violationLines(resp.EventViolations(e.Index), m.colors.Theme, add)
+	}
+
+	lines = append(lines, tuiLine{})
+	add(m.colors.Theme.Info, " ", "stream")
+	violationLines(resp.EventViolations(0), m.colors.Theme, add)
+	return lines
+}
+
+func violationLines(violations []Violation, theme Theme, add func(color string, indent string, text string)) {
+	if len(violations) == 0 {
+		add(theme.Debug, " ", "✓ valid")
+		return
+	}
+	for _, v := range violations {
+		color := theme.Info
+		switch v.Severity {
+		case SeverityError:
+			color = theme.Error
+		case SeverityWarning:
+			color = theme.Warning
+		}
+		add(color, " ", v.String())
+	}
+}
+
+// errorDetails describes why a turn failed.
+func errorDetails(err error) string {
+	var httpErr *HTTPError
+	var interruptedErr *InterruptedError
+	switch {
+	case errors.As(err, &httpErr):
+		return strings.TrimSpace(httpErr.Details())
+	case errors.As(err, &interruptedErr):
+		return strings.TrimSpace(interruptedErr.Details())
+	default:
+		return fmt.Sprintf("Alas...%s", err)
+	}
+}
+
+// wrapText splits text into lines no wider than width, breaking long lines
+// wherever they reach the width.
+func wrapText(text string, width int) []string {
+	width = max(width, 1)
+	text = strings.ReplaceAll(text, "\t", "    ")
+	text = strings.ReplaceAll(text, "\r", "")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		for runewidth.StringWidth(line) > width {
+			cut := runewidth.Truncate(line, width, "")
+			if cut == "" {
+				// a rune wider than the pane
+				_, size := utf8.DecodeRuneInString(line)
+				cut = line[:size]
+			}
+			lines = append(lines, cut)
+			line = line[len(cut):]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fitLine pads or truncates a line to exactly width columns.
+func fitLine(s string, width int) string {
+	return runewidth.FillRight(runewidth.Truncate(s, width, ""), width)
+}
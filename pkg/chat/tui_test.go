@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTUIModel_HandleKey(t *testing.T) {
+	m := &tuiModel{username: "octocat", width: 80, height: 24, colors: DefaultColors}
+
+	for _, r := range "hi!" {
+		m.handleKey(tuiKey{code: keyRune, r: r})
+	}
+	m.handleKey(tuiKey{code: keyBackspace})
+	action, line := m.handleKey(tuiKey{code: keyEnter})
+	assert.Equal(t, tuiSend, action)
+	assert.Equal(t, "hi", line)
+	assert.Empty(t, m.input)
+
+	action, _ = m.handleKey(tuiKey{code: keyEnter})
+	assert.Equal(t, tuiNone, action, "empty lines are not sent")
+
+	m.handleKey(tuiKey{code: keyTab})
+	assert.Equal(t, paneTimeline, m.focus)
+	m.handleKey(tuiKey{code: keyPageDown})
+	assert.Equal(t, 21, m.timelineScroll)
+	m.handleKey(tuiKey{code: keyHome})
+	assert.Equal(t, 0, m.timelineScroll)
+
+	m.addTurn("one")
+	m.addTurn("two")
+	assert.Equal(t, 1, m.selected)
+	m.handleKey(tuiKey{code: keyCtrlP})
+	m.handleKey(tuiKey{code: keyCtrlP})
+	assert.Equal(t, 0, m.selected)
+	m.handleKey(tuiKey{code: keyCtrlN})
+	assert.Equal(t, 1, m.selected)
+
+	action, _ = m.handleKey(tuiKey{code: keyCtrlC})
+	assert.Equal(t, tuiInterrupt, action)
+	action, _ = m.handleKey(tuiKey{code: keyCtrlD})
+	assert.Equal(t, tuiQuit, action)
+}
+
+func tuiTestModel() *tuiModel {
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := &tuiModel{username: "octocat", width: 80, height: 24, colors: DefaultColors}
+	m.turns = []*tuiTurn{
+		{
+			prompt:  "hello",
+			started: started,
+			resp: &Response{
+				Messages: []*Message{{Role: "assistant", Content: "Ahoy"}},
+				Violations: []Violation{
+					{Rule: RuleSSEUnsupportedField, Severity: SeverityWarning, Message: "ignored unknown field \"foo\"", Event: 1},
+					{Rule: RuleStreamMissingDone, Severity: SeverityWarning, Message: "no done"},
+				},
+				Timeline: []TimelineEvent{
+					{
+						Index:    1,
+						Received: started.Add(15 * time.Millisecond),
+						Raw:      "foo: bar\ndata: {\"choices\":[]}\n",
+						Parsed:   []Event{{Type: EventCompletion, Completion: &Completion{}}},
+					},
+					{
+						Index:    2,
+						Received: started.Add(20 * time.Millisecond),
+						Raw:      "data: oops\n",
+					},
+				},
+			},
+		},
+		{prompt: "again", pending: true},
+	}
+	m.selected = 1
+	return m
+}
+
+func TestTUIModel_ConversationLines(t *testing.T) {
+	m := tuiTestModel()
+
+	var texts []string
+	for _, l := range m.conversationLines(40) {
+		texts = append(texts, l.text)
+	}
+	assert.Equal(t, []string{
+		"  octocat: hello",
+		"  assistant:",
+		"  Ahoy",
+		"  2 events, 2 violations",
+		"",
+		"▶ octocat: again",
+		"  waiting for the agent...",
+		"",
+	}, texts)
+}
+
+func TestTUIModel_TimelineLines(t *testing.T) {
+	m := tuiTestModel()
+	m.selected = 0
+
+	var texts []string
+	for _, l := range m.timelineLines(40) {
+		texts = append(texts, l.text)
+	}
+	assert.Equal(t, []string{
+		" 2 events in 0s",
+		"",
+		" #1  12:00:00.015  +15ms",
+		" raw:",
+		"   foo: bar",
+		"   data: {\"choices\":[]}",
+		" parsed:",
+		"   [{\"type\":\"completion\",\"completion\":{\"",
+		"   choices\":null}}]",
+		" [warning] sse.unsupported-field: ignore",
+		" d unknown field \"foo\"",
+		"",
+		" #2  12:00:00.020  +20ms",
+		" raw:",
+		"   data: oops",
+		" parsed: nothing",
+		" ✓ valid",
+		"",
+		" stream",
+		" [warning] stream.missing-done: no done",
+	}, texts)
+
+	m.selected = 1
+	assert.Equal(t, []tuiLine{{text: " Waiting for the agent...", color: DefaultTheme.Info}}, m.timelineLines(40))
+}
+
+func TestTUIModel_View(t *testing.T) {
+	m := tuiTestModel()
+	m.colors = Colors{}
+	m.input = []rune("typing")
+	view := m.view()
+
+	// every row of the screen is drawn at its position
+	for row := 2; row <= m.height; row++ {
+		assert.Contains(t, view, fmt.Sprintf("\x1b[%d;1H", row))
+	}
+	assert.Contains(t, view, " Events of turn 2 of 2")
+	assert.Contains(t, view, "octocat: typing")
+	assert.Contains(t, view, "\x1b[24;16H", "the cursor is left after the input")
+
+	m.height = 3
+	assert.Contains(t, m.view(), "The terminal is too small")
+}
+
+func TestWrapText(t *testing.T) {
+	assert.Equal(t, []string{"abcd", "ef"}, wrapText("abcdef", 4))
+	assert.Equal(t, []string{"ab", "", "cd"}, wrapText("ab\n\ncd", 4))
+	assert.Equal(t, []string{"日本", "語"}, wrapText("日本語", 4))
+	assert.Equal(t, []string{"    x"}, wrapText("\tx", 10))
+}
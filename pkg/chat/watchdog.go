@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxTail is the number of trailing response bytes kept to diagnose a turn
+// that was cut short.
+const maxTail = 512
+
+// watchdogReader wraps a response body, cancelling the request when no bytes
+// have been read for longer than the idle timeout. It also keeps track of what
+// was received so far to explain where an interrupted stream stopped.
+type watchdogReader struct {
+	mu      sync.Mutex
+	r       io.Reader
+	idle    time.Duration
+	timer   *time.Timer
+	stalled bool
+	bytes   int64
+	tail    []byte
+}
+
+// newWatchdog starts the idle timer right away, so it also covers the time spent
+// waiting for the response headers. An idle timeout of zero disables it.
+func newWatchdog(idle time.Duration, cancel context.CancelFunc) *watchdogReader {
+	w := &watchdogReader{idle: idle}
+	if idle > 0 {
+		w.timer = time.AfterFunc(idle, func() {
+			w.mu.Lock()
+			w.stalled = true
+			w.mu.Unlock()
+			cancel()
+		})
+	}
+	return w
+}
+
+// Watch sets the reader the watchdog reads from.
+func (w *watchdogReader) Watch(r io.Reader) {
+	w.r = r
+}
+
+func (w *watchdogReader) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if n > 0 {
+		if w.timer != nil {
+			w.timer.Reset(w.idle)
+		}
+
+		w.mu.Lock()
+		w.bytes += int64(n)
+		w.tail = append(w.tail, p[:n]...)
+		if len(w.tail) > maxTail {
+			w.tail = w.tail[len(w.tail)-maxTail:]
+		}
+		w.mu.Unlock()
+	}
+	return n, err
+}
+
+// Bytes returns the number of bytes read so far.
+func (w *watchdogReader) Bytes() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.bytes
+}
+
+// Stop disarms the idle timer.
+func (w *watchdogReader) Stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// Interrupted builds the error describing why and where the stream was cut
+// short.
+func (w *watchdogReader) Interrupted(ctxErr error, msgs []*Message) *InterruptedError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cause := ctxErr
+	if w.stalled {
+		cause = ErrStalled
+	}
+
+	return &InterruptedError{
+		Cause:       cause,
+		IdleTimeout: w.idle,
+		Bytes:       w.bytes,
+		Tail:        append([]byte(nil), w.tail...),
+		Messages:    msgs,
+	}
+}
@@ -0,0 +1,311 @@
+package doctor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+)
+
+// slowFirstByte is the time to first byte above which the agent is reported
+// as slow to respond.
+const slowFirstByte = 2 * time.Second
+
+// invalidToken is sent to check that the agent does not blindly trust the
+// X-GitHub-Token header.
+const invalidToken = "gh-debug-cli-invalid-token"
+
+// Result is the outcome of a single preflight check.
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// Options configures a doctor run.
+type Options struct {
+	URL   string
+	Token string
+
+	// Timeout limits each request sent to the agent. 0 means no limit.
+	Timeout time.Duration
+
+	// Signer signs the checks sent to the agent, except the one making sure
+	// unsigned requests are rejected. Checks are unsigned when nil.
+	Signer chat.Signer
+
+	// Redactor masks the secrets in the details of the results. Defaults to a
+	// Redactor masking the DefaultSecretPatterns and the token.
+	Redactor *chat.Redactor
+}
+
+// probe is the outcome of a single request sent to the agent.
+type probe struct {
+	resp      *http.Response
+	body      []byte
+	firstByte time.Duration
+}
+
+// Run preflights the agent at opts.URL and returns the result of every check in
+// the order they were run. Checks that depend on an earlier check that failed
+// are not run.
+func Run(ctx context.Context, opts Options) ([]Result, error) {
+	redactor := opts.Redactor
+	if redactor == nil {
+		var err error
+		if redactor, err = chat.NewRedactor(); err != nil {
+			return nil, err
+		}
+		redactor.AddSecret(opts.Token)
+	}
+
+	if opts.URL == "" {
+		return nil, fmt.Errorf("agent url is required")
+	}
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid agent url: %s", redactor.String(opts.URL))
+	}
+
+	results := run(ctx, opts, u)
+	for i := range results {
+		results[i].Detail = redactor.String(results[i].Detail)
+	}
+	return results, nil
+}
+
+// run runs the checks in order, until one the others depend on fails.
+func run(ctx context.Context, opts Options, u *url.URL) []Result {
+	client := &http.Client{Timeout: opts.Timeout}
+
+	var results []Result
+
+	reachable := checkReachable(u, opts.Timeout)
+	results = append(results, reachable)
+	if reachable.Status == StatusFail {
+		return results
+	}
+
+	p, err := send(ctx, client, opts.URL, opts.Token, opts.Signer)
+	if err != nil {
+		results = append(results, Result{Name: "POST accepted", Status: StatusFail, Detail: err.Error()})
+		return results
+	}
+
+	results = append(results, checkPost(p))
+	results = append(results, checkStatus(p, opts.Signer != nil))
+	results = append(results, checkUnsigned(ctx, client, opts, p))
+	if p.resp.StatusCode < 200 || p.resp.StatusCode > 299 {
+		return results
+	}
+
+	results = append(results, checkContentType(p))
+	results = append(results, checkDone(p))
+	results = append(results, checkFirstByte(p))
+	results = append(results, checkToken(ctx, client, opts))
+
+	return results
+}
+
+// Failed reports whether any of the results failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Result) String() string {
+	return r.Format(chat.Colors{})
+}
+
+// Format formats the result as a line, with its status colored.
+func (r Result) Format(colors chat.Colors) string {
+	color := chat.ColorGreen
+	switch r.Status {
+	case StatusWarn:
+		color = chat.ColorYellow
+	case StatusFail:
+		color = chat.ColorRed
+	}
+
+	status := colors.Colorize(color, fmt.Sprintf("[%s]", r.Status))
+	if r.Detail == "" {
+		return fmt.Sprintf("%s %s\n", status, r.Name)
+	}
+	return fmt.Sprintf("%s %s: %s\n", status, r.Name, r.Detail)
+}
+
+func checkReachable(u *url.URL, timeout time.Duration) Result {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return Result{Name: "TCP reachability", Status: StatusFail, Detail: fmt.Sprintf("could not connect to %s: %v", addr, err)}
+	}
+	conn.Close()
+
+	return Result{Name: "TCP reachability", Status: StatusPass, Detail: addr}
+}
+
+func checkPost(p *probe) Result {
+	if p.resp.StatusCode == http.StatusMethodNotAllowed {
+		return Result{Name: "POST accepted", Status: StatusFail, Detail: "agent responded with 405 Method Not Allowed"}
+	}
+	return Result{Name: "POST accepted", Status: StatusPass}
+}
+
+// checkStatus checks the status of the first probe. An agent verifying payload
+// signatures is expected to reject it when it is unsigned, in which case the
+// checks of the response are skipped.
+func checkStatus(p *probe, signed bool) Result {
+	code := p.resp.StatusCode
+	switch {
+	case code >= 200 && code <= 299:
+		return Result{Name: "Response status", Status: StatusPass, Detail: p.resp.Status}
+	case (code == http.StatusUnauthorized || code == http.StatusForbidden) && !signed:
+		return Result{Name: "Response status", Status: StatusWarn, Detail: fmt.Sprintf("%s; the agent rejects unsigned requests, pass --private-key to sign the checks and run the rest of them", p.resp.Status)}
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return Result{Name: "Response status", Status: StatusFail, Detail: fmt.Sprintf("%s; check that the agent verifies signatures with the public key of --private-key", p.resp.Status)}
+	case code == http.StatusNotFound:
+		return Result{Name: "Response status", Status: StatusFail, Detail: fmt.Sprintf("%s; check the agent route in --url", p.resp.Status)}
+	default:
+		return Result{Name: "Response status", Status: StatusFail, Detail: p.resp.Status}
+	}
+}
+
+// checkUnsigned checks that the agent rejects unsigned requests, sending one
+// when the first probe was signed.
+func checkUnsigned(ctx context.Context, client *http.Client, opts Options, p *probe) Result {
+	if opts.Signer != nil {
+		var err error
+		if p, err = send(ctx, client, opts.URL, opts.Token, nil); err != nil {
+			return Result{Name: "Rejects unsigned requests", Status: StatusFail, Detail: err.Error()}
+		}
+	}
+
+	code := p.resp.StatusCode
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return Result{Name: "Rejects unsigned requests", Status: StatusPass}
+	}
+	return Result{Name: "Rejects unsigned requests", Status: StatusWarn, Detail: "agent accepted a request without a payload signature; make sure verification is enabled before deploying"}
+}
+
+func checkContentType(p *probe) Result {
+	contentType := p.resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return Result{Name: "Content-Type", Status: StatusPass, Detail: contentType}
+	}
+	if contentType == "" {
+		contentType = "none"
+	}
+	return Result{Name: "Content-Type", Status: StatusFail, Detail: fmt.Sprintf("expected text/event-stream, found %s", contentType)}
+}
+
+func checkDone(p *probe) Result {
+	var last string
+	scanner := bufio.NewScanner(bytes.NewReader(p.body))
+	scanner.Buffer(nil, len(p.body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "data:") {
+			last = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	switch {
+	case last == "[DONE]":
+		return Result{Name: "Stream ends with [DONE]", Status: StatusPass}
+	case len(p.body) == 0:
+		return Result{Name: "Stream ends with [DONE]", Status: StatusFail, Detail: "the response body was empty"}
+	default:
+		return Result{Name: "Stream ends with [DONE]", Status: StatusWarn, Detail: "the stream ended without a final `data: [DONE]`"}
+	}
+}
+
+func checkFirstByte(p *probe) Result {
+	if p.firstByte > slowFirstByte {
+		return Result{Name: "Time to first byte", Status: StatusWarn, Detail: fmt.Sprintf("%s exceeds %s", p.firstByte.Round(time.Millisecond), slowFirstByte)}
+	}
+	return Result{Name: "Time to first byte", Status: StatusPass, Detail: p.firstByte.Round(time.Millisecond).String()}
+}
+
+func checkToken(ctx context.Context, client *http.Client, opts Options) Result {
+	if opts.Token == "" {
+		return Result{Name: "Honors X-GitHub-Token", Status: StatusWarn, Detail: "skipped, no --token provided"}
+	}
+
+	p, err := send(ctx, client, opts.URL, invalidToken, opts.Signer)
+	if err != nil {
+		return Result{Name: "Honors X-GitHub-Token", Status: StatusFail, Detail: err.Error()}
+	}
+
+	if p.resp.StatusCode < 200 || p.resp.StatusCode > 299 || bytes.Contains(p.body, []byte("copilot_errors")) {
+		return Result{Name: "Honors X-GitHub-Token", Status: StatusPass, Detail: "an invalid token was rejected"}
+	}
+	return Result{Name: "Honors X-GitHub-Token", Status: StatusWarn, Detail: "agent responded successfully to an invalid token"}
+}
+
+// send posts a preflight message to the agent, signed by signer unless nil.
+// The request is built by the chat client, only its timing is traced here.
+func send(ctx context.Context, client *http.Client, agentURL string, token string, signer chat.Signer) (*probe, error) {
+	chatClient, err := chat.NewClient(chat.WithURL(agentURL), chat.WithToken(token), chat.WithSigner(signer))
+	if err != nil {
+		return nil, err
+	}
+
+	var start time.Time
+	var firstByte time.Duration
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			firstByte = time.Since(start)
+		},
+	}
+
+	req, err := chatClient.NewRequest(httptrace.WithClientTrace(ctx, trace), []chat.Message{
+		{Role: "user", Content: "Hello! This is a preflight check from gh debug-cli."},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	return &probe{resp: resp, body: respBody, firstByte: firstByte}, nil
+}
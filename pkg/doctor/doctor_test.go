@@ -0,0 +1,206 @@
+package doctor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSigner creates a signer with a new private key.
+func newTestSigner(t *testing.T) chat.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	signer, err := chat.NewKeySigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	return signer
+}
+
+// requireSignature rejects the requests without a payload signature.
+func requireSignature(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Github-Public-Key-Signature") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		token          string
+		signed         bool
+		expectedStatus map[string]Status
+	}{
+		{
+			name: "happy_path",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-GitHub-Token") == invalidToken {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy\"}}]}\n\ndata: [DONE]\n\n")
+			},
+			token: "token",
+			expectedStatus: map[string]Status{
+				"TCP reachability":          StatusPass,
+				"POST accepted":             StatusPass,
+				"Response status":           StatusPass,
+				"Rejects unsigned requests": StatusWarn,
+				"Content-Type":              StatusPass,
+				"Stream ends with [DONE]":   StatusPass,
+				"Time to first byte":        StatusPass,
+				"Honors X-GitHub-Token":     StatusPass,
+			},
+		},
+		{
+			name: "failure_not_event_stream",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"message": "hello"}`)
+			},
+			expectedStatus: map[string]Status{
+				"TCP reachability":          StatusPass,
+				"POST accepted":             StatusPass,
+				"Response status":           StatusPass,
+				"Rejects unsigned requests": StatusWarn,
+				"Content-Type":              StatusFail,
+				"Stream ends with [DONE]":   StatusWarn,
+				"Time to first byte":        StatusPass,
+				"Honors X-GitHub-Token":     StatusWarn,
+			},
+		},
+		{
+			name: "happy_path_signed",
+			handler: requireSignature(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ahoy\"}}]}\n\ndata: [DONE]\n\n")
+			}),
+			signed: true,
+			expectedStatus: map[string]Status{
+				"TCP reachability":          StatusPass,
+				"POST accepted":             StatusPass,
+				"Response status":           StatusPass,
+				"Rejects unsigned requests": StatusPass,
+				"Content-Type":              StatusPass,
+				"Stream ends with [DONE]":   StatusPass,
+				"Time to first byte":        StatusPass,
+				"Honors X-GitHub-Token":     StatusWarn,
+			},
+		},
+		{
+			name: "unsigned_probe_rejected",
+			handler: requireSignature(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the probe should not be signed")
+			}),
+			expectedStatus: map[string]Status{
+				"TCP reachability":          StatusPass,
+				"POST accepted":             StatusPass,
+				"Response status":           StatusWarn,
+				"Rejects unsigned requests": StatusPass,
+			},
+		},
+		{
+			name: "failure_signed_probe_rejected",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			signed: true,
+			expectedStatus: map[string]Status{
+				"TCP reachability":          StatusPass,
+				"POST accepted":             StatusPass,
+				"Response status":           StatusFail,
+				"Rejects unsigned requests": StatusPass,
+			},
+		},
+		{
+			name: "failure_method_not_allowed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			},
+			expectedStatus: map[string]Status{
+				"TCP reachability":          StatusPass,
+				"POST accepted":             StatusFail,
+				"Response status":           StatusFail,
+				"Rejects unsigned requests": StatusWarn,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			opts := Options{URL: server.URL, Token: tt.token}
+			if tt.signed {
+				opts.Signer = newTestSigner(t)
+			}
+			results, err := Run(context.Background(), opts)
+			assert.NoError(t, err)
+
+			actualStatus := map[string]Status{}
+			for _, r := range results {
+				actualStatus[r.Name] = r.Status
+			}
+			assert.Equal(t, tt.expectedStatus, actualStatus)
+		})
+	}
+}
+
+func TestRun_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	results, err := Run(context.Background(), Options{URL: url})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, StatusFail, results[0].Status)
+	assert.True(t, Failed(results))
+}
+
+func TestRun_MissingURL(t *testing.T) {
+	_, err := Run(context.Background(), Options{})
+	assert.Equal(t, fmt.Errorf("agent url is required"), err)
+}
+
+func TestRun_Redacted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// drop the connection, so the error names the url
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer server.Close()
+
+	redactor, err := chat.NewRedactor(`acme_[0-9]+`)
+	require.NoError(t, err)
+
+	results, err := Run(context.Background(), Options{URL: server.URL + "/agent?key=acme_0123456789", Redactor: redactor})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, StatusFail, results[1].Status)
+	assert.Contains(t, results[1].Detail, "key="+chat.Redacted)
+	assert.NotContains(t, results[1].Detail, "acme_0123456789")
+
+	_, err = Run(context.Background(), Options{URL: "acme_0123456789", Redactor: redactor})
+	assert.EqualError(t, err, "invalid agent url: "+chat.Redacted)
+}
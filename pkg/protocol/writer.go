@@ -0,0 +1,182 @@
+// Package protocol writes agent responses in the Copilot SSE wire format, as
+// parsed by the chat package.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+)
+
+const (
+	eventConfirmation = "copilot_confirmation"
+	eventReferences   = "copilot_references"
+	eventErrors       = "copilot_errors"
+
+	doneData = "[DONE]"
+)
+
+// chunk is a chunk of the assistant message, in the format of the OpenAI chat
+// completion chunks.
+type chunk struct {
+	Choices []choice `json:"choices"`
+}
+
+type choice struct {
+	Index        int    `json:"index"`
+	Delta        delta  `json:"delta"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// delta is what a chunk adds to the assistant message. Every field is left out
+// when empty, so the chunk finishing the message has an empty delta.
+type delta struct {
+	Role         string                        `json:"role,omitempty"`
+	Content      string                        `json:"content,omitempty"`
+	FunctionCall *chat.ChatMessageFunctionCall `json:"function_call,omitempty"`
+	ToolCalls    []chat.ToolCall               `json:"tool_calls,omitempty"`
+}
+
+// Writer writes the events of an agent response. Every event is flushed as
+// soon as it is written when the underlying writer is an http.Flusher.
+type Writer struct {
+	w            io.Writer
+	role         string
+	sentRole     bool
+	finishReason string
+	done         bool
+	wroteHeader  bool
+}
+
+// NewWriter creates a Writer. When w is an http.ResponseWriter, the SSE
+// response headers are set before the first event is written.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:            w,
+		role:         "assistant",
+		finishReason: "stop",
+	}
+}
+
+// WriteText writes a chunk of the assistant message. The role is only sent
+// with the first chunk.
+func (w *Writer) WriteText(content string) error {
+	return w.writeDelta(delta{Content: content})
+}
+
+// WriteFunctionCall writes a function call from the assistant.
+func (w *Writer) WriteFunctionCall(name string, arguments string) error {
+	w.finishReason = "function_call"
+	return w.writeDelta(delta{
+		FunctionCall: &chat.ChatMessageFunctionCall{
+			Name:      name,
+			Arguments: arguments,
+		},
+	})
+}
+
+// WriteToolCalls writes tool calls from the assistant.
+func (w *Writer) WriteToolCalls(calls ...chat.ToolCall) error {
+	if len(calls) == 0 {
+		return fmt.Errorf("at least one tool call is required")
+	}
+	w.finishReason = "tool_calls"
+	return w.writeDelta(delta{ToolCalls: calls})
+}
+
+// WriteReferences writes a copilot_references event.
+func (w *Writer) WriteReferences(refs ...chat.Reference) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("at least one reference is required")
+	}
+	return w.writeEvent(eventReferences, refs)
+}
+
+// WriteErrors writes a copilot_errors event.
+func (w *Writer) WriteErrors(errs ...chat.CopilotError) error {
+	if len(errs) == 0 {
+		return fmt.Errorf("at least one error is required")
+	}
+	return w.writeEvent(eventErrors, errs)
+}
+
+// WriteConfirmation writes a copilot_confirmation event.
+func (w *Writer) WriteConfirmation(c chat.Confirmation) error {
+	return w.writeEvent(eventConfirmation, c)
+}
+
+// WriteDone ends the response, finishing the assistant message when one was
+// written. Nothing can be written afterwards.
+func (w *Writer) WriteDone() error {
+	if w.sentRole && !w.done {
+		finish := chunk{
+			Choices: []choice{{FinishReason: w.finishReason}},
+		}
+		if err := w.writeEvent("", finish); err != nil {
+			return err
+		}
+	}
+
+	if err := w.write("", []byte(doneData)); err != nil {
+		return err
+	}
+	w.done = true
+	return nil
+}
+
+func (w *Writer) writeDelta(d delta) error {
+	if !w.sentRole {
+		d.Role = w.role
+	}
+
+	c := chunk{
+		Choices: []choice{{Delta: d}},
+	}
+	if err := w.writeEvent("", c); err != nil {
+		return err
+	}
+
+	w.sentRole = true
+	return nil
+}
+
+func (w *Writer) writeEvent(event string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+	return w.write(event, b)
+}
+
+func (w *Writer) write(event string, data []byte) error {
+	if w.done {
+		return fmt.Errorf("cannot write after [DONE]")
+	}
+
+	if rw, ok := w.w.(http.ResponseWriter); ok && !w.wroteHeader {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("Connection", "keep-alive")
+	}
+	w.wroteHeader = true
+
+	var frame []byte
+	if event != "" {
+		frame = append(frame, fmt.Sprintf("event: %s\n", event)...)
+	}
+	frame = append(frame, "data: "...)
+	frame = append(frame, data...)
+	frame = append(frame, "\n\n"...)
+
+	if _, err := w.w.Write(frame); err != nil {
+		return fmt.Errorf("error writing event: %w", err)
+	}
+
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := NewWriter(rec)
+
+	assert.NoError(t, w.WriteReferences(chat.Reference{
+		Type:     "github.repository",
+		ID:       "1",
+		Metadata: chat.ReferenceMetadata{DisplayName: "gh-debug-cli"},
+	}))
+	assert.NoError(t, w.WriteText("Ahoy, "))
+	assert.NoError(t, w.WriteText("matey!"))
+	assert.NoError(t, w.WriteDone())
+
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, `event: copilot_references
+data: [{"type":"github.repository","id":"1","data":null,"metadata":{"display_name":"gh-debug-cli","display_icon":"","display_url":""}}]
+
+data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Ahoy, "}}]}
+
+data: {"choices":[{"index":0,"delta":{"content":"matey!"}}]}
+
+data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`, rec.Body.String())
+
+	violations, err := chat.Validate(context.Background(), bytes.NewReader(rec.Body.Bytes()), chat.ParseModeStrict, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestWriter_FunctionCall(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	assert.NoError(t, w.WriteFunctionCall("get_weather", `{"city":"Paris"}`))
+	assert.NoError(t, w.WriteDone())
+
+	assert.Equal(t, `data: {"choices":[{"index":0,"delta":{"role":"assistant","function_call":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}}]}
+
+data: {"choices":[{"index":0,"delta":{},"finish_reason":"function_call"}]}
+
+data: [DONE]
+
+`, buf.String())
+}
+
+func TestWriter_Events(t *testing.T) {
+	testCases := []struct {
+		name  string
+		write func(w *Writer) error
+	}{
+		{
+			name: "confirmation",
+			write: func(w *Writer) error {
+				if err := w.WriteText("The feature flag is on."); err != nil {
+					return err
+				}
+				return w.WriteConfirmation(chat.Confirmation{
+					Type:         "action",
+					Title:        "Turn off feature flag",
+					Message:      "Are you sure?",
+					Confirmation: map[string]string{"id": "123"},
+				})
+			},
+		},
+		{
+			name: "errors",
+			write: func(w *Writer) error {
+				return w.WriteErrors(chat.CopilotError{Type: "agent", Code: "E1", Message: "Something went wrong", Identifier: "agent-1"})
+			},
+		},
+		{
+			name: "function_call",
+			write: func(w *Writer) error {
+				return w.WriteFunctionCall("get_weather", `{"city":"Paris"}`)
+			},
+		},
+		{
+			name: "tool_calls",
+			write: func(w *Writer) error {
+				return w.WriteToolCalls(chat.ToolCall{ID: "call_1", Type: "function", Function: chat.ChatMessageFunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}})
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+
+			assert.NoError(t, tc.write(w))
+			assert.NoError(t, w.WriteDone())
+			violations, err := chat.Validate(context.Background(), bytes.NewReader(buf.Bytes()), chat.ParseModeStrict, nil)
+			assert.NoError(t, err)
+			assert.Empty(t, violations)
+		})
+	}
+}
+
+func TestWriter_AfterDone(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	assert.NoError(t, w.WriteDone())
+	assert.EqualError(t, w.WriteText("too late"), "cannot write after [DONE]")
+}
@@ -0,0 +1,224 @@
+// Package ui serves a web page to chat with an agent from a browser, showing
+// the same parsed events, rule violations and metrics as the terminal chat.
+package ui
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+)
+
+//go:embed static
+var static embed.FS
+
+// maxRequestBody bounds the conversation history a page may send.
+const maxRequestBody = 10 << 20
+
+// Options configures a Server.
+type Options struct {
+	// ClientOptions configure the client every turn is sent with. WithURL is
+	// required.
+	ClientOptions []chat.ClientOption
+
+	// Timeout bounds how long a single turn may take. Zero means no limit.
+	Timeout time.Duration
+
+	// Addr is the address the page is served on, e.g. 127.0.0.1:8090.
+	// Requests naming another host are rejected, so a site resolving its own
+	// domain to this address cannot chat with the agent.
+	Addr string
+
+	// Redactor masks the secrets in the events, responses and errors relayed
+	// to the page. A nil Redactor masks nothing.
+	Redactor *chat.Redactor
+}
+
+// Server serves the web page and relays its turns to the agent.
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+}
+
+// turnRequest is a turn sent by the page.
+type turnRequest struct {
+	Messages []chat.Message `json:"messages"`
+	ThreadID string         `json:"thread_id"`
+}
+
+// streamedEvent is an event of the agent response, as relayed to the page.
+type streamedEvent struct {
+	// Elapsed is the time since the turn was sent, in milliseconds.
+	Elapsed int64      `json:"elapsed"`
+	Event   chat.Event `json:"event"`
+}
+
+// turnError is why a turn failed, as relayed to the page.
+type turnError struct {
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+
+	// Messages are the messages received before an interrupted turn stopped.
+	Messages []*chat.Message `json:"messages,omitempty"`
+}
+
+// NewServer creates a Server.
+func NewServer(opts Options) (*Server, error) {
+	// fail early on options the client rejects
+	if _, err := chat.NewClient(opts.ClientOptions...); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := net.SplitHostPort(opts.Addr); err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", opts.Addr, err)
+	}
+
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{opts: opts, mux: http.NewServeMux()}
+	s.mux.Handle("/", http.FileServer(http.FS(assets)))
+	s.mux.HandleFunc("/api/chat", s.handleChat)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.allowedHost(r.Host) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return
+	}
+	// browsers send the origin of cross-origin requests, e.g. a form posted
+	// by another site
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+		http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// allowedHost reports whether the Host of a request names the address the page
+// is served on: the same port on the bound host, on localhost or a loopback
+// address when bound to one, or on any address when bound to all of them.
+func (s *Server) allowedHost(host string) bool {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return false
+	}
+	boundHost, boundPort, _ := net.SplitHostPort(s.opts.Addr)
+	if port != boundPort {
+		return false
+	}
+	if strings.EqualFold(hostname, boundHost) {
+		return true
+	}
+
+	ip := net.ParseIP(hostname)
+	isLoopback := strings.EqualFold(hostname, "localhost") || (ip != nil && ip.IsLoopback())
+	bound := net.ParseIP(boundHost)
+	switch {
+	case boundHost == "" || (bound != nil && bound.IsUnspecified()):
+		// only domains can be rebound to the address
+		return ip != nil || isLoopback
+	case strings.EqualFold(boundHost, "localhost") || (bound != nil && bound.IsLoopback()):
+		return isLoopback
+	default:
+		return false
+	}
+}
+
+// handleChat sends a turn to the agent and streams its events back to the
+// page as server-sent events: an `event` for every parsed event, then either
+// the assembled `response` or an `error`, and finally `done`.
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// other sites can only send JSON after a CORS preflight, which is never
+	// allowed, so they cannot chat with the agent through the page
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req turnRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	clientOpts := s.opts.ClientOptions
+	if req.ThreadID != "" {
+		clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], chat.WithThreadID(req.ThreadID))
+	}
+	client, err := chat.NewClient(clientOpts...)
+	if err != nil {
+		http.Error(w, s.opts.Redactor.String(err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	if s.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Timeout)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, data any) {
+		b, err := json.Marshal(data)
+		if err != nil {
+			b, _ = json.Marshal(turnError{Message: fmt.Sprintf("error marshaling %s: %v", event, err)})
+			event = "error"
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, s.opts.Redactor.Bytes(b))
+		flusher.Flush()
+	}
+
+	start := time.Now()
+	stream := client.Stream(ctx, req.Messages)
+	for e := range stream.Events() {
+		send("event", streamedEvent{Elapsed: time.Since(start).Milliseconds(), Event: e})
+	}
+
+	resp, err := stream.Wait()
+	if err != nil {
+		send("error", newTurnError(err))
+	} else {
+		send("response", resp)
+	}
+	send("done", struct{}{})
+}
+
+func newTurnError(err error) turnError {
+	var httpErr *chat.HTTPError
+	var interruptedErr *chat.InterruptedError
+	switch {
+	case errors.As(err, &httpErr):
+		return turnError{Message: httpErr.Error(), Details: strings.TrimSpace(httpErr.Details())}
+	case errors.As(err, &interruptedErr):
+		return turnError{Message: interruptedErr.Error(), Details: strings.TrimSpace(interruptedErr.Details()), Messages: interruptedErr.Messages}
+	default:
+		return turnError{Message: err.Error()}
+	}
+}
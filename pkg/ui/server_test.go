@@ -0,0 +1,279 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/github-technology-partners/gh-debug-cli/pkg/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is a server-sent event relayed to the page.
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, body io.Reader) []sseEvent {
+	b, err := io.ReadAll(body)
+	require.NoError(t, err)
+
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(string(b)), "\n\n") {
+		var e sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				e.name = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				e.data = data
+			}
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func newTestServer(t *testing.T, agent http.HandlerFunc) *httptest.Server {
+	return newTestServerWithOptions(t, agent, Options{})
+}
+
+// newTestServerWithOptions serves the page with opts, relaying its turns to
+// agent.
+func newTestServerWithOptions(t *testing.T, agent http.HandlerFunc, opts Options) *httptest.Server {
+	agentServer := httptest.NewServer(agent)
+	t.Cleanup(agentServer.Close)
+
+	server := httptest.NewUnstartedServer(nil)
+	opts.ClientOptions = append(opts.ClientOptions, chat.WithURL(agentServer.URL))
+	opts.Addr = server.Listener.Addr().String()
+	s, err := NewServer(opts)
+	require.NoError(t, err)
+
+	server.Config.Handler = s
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestServer_Chat(t *testing.T) {
+	var request chat.Request
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"ahoy\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	resp, err := http.Post(server.URL+"/api/chat", "application/json", strings.NewReader(`{"messages":[{"role":"user","content":"hello"}],"thread_id":"thread-1"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := readEvents(t, resp.Body)
+	require.Len(t, events, 3)
+
+	assert.Equal(t, "event", events[0].name)
+	var streamed streamedEvent
+	require.NoError(t, json.Unmarshal([]byte(events[0].data), &streamed))
+	assert.Equal(t, chat.EventCompletion, streamed.Event.Type)
+
+	assert.Equal(t, "response", events[1].name)
+	var response chat.Response
+	require.NoError(t, json.Unmarshal([]byte(events[1].data), &response))
+	require.Len(t, response.Messages, 1)
+	assert.Equal(t, "ahoy", response.Messages[0].Content)
+	assert.Len(t, response.Timeline, 2)
+
+	assert.Equal(t, "done", events[2].name)
+
+	assert.Equal(t, "thread-1", request.CopilotThreadID)
+	assert.Equal(t, []chat.Message{{Role: "user", Content: "hello"}}, request.Messages)
+}
+
+func TestServer_Chat_AgentError(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no route", http.StatusNotFound)
+	})
+
+	resp, err := http.Post(server.URL+"/api/chat", "application/json", strings.NewReader(`{"messages":[]}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	events := readEvents(t, resp.Body)
+	require.Len(t, events, 2)
+	assert.Equal(t, "error", events[0].name)
+
+	var turnErr turnError
+	require.NoError(t, json.Unmarshal([]byte(events[0].data), &turnErr))
+	assert.Equal(t, "agent responded with 404 Not Found (route not found)", turnErr.Message)
+	assert.Contains(t, turnErr.Details, "Check the path passed with --url")
+	assert.Equal(t, "done", events[1].name)
+}
+
+func TestServer_Chat_Redacted(t *testing.T) {
+	const secret = "acme_0123456789"
+	redactor, err := chat.NewRedactor(`acme_[0-9]+`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		agent http.HandlerFunc
+	}{
+		{
+			name: "response",
+			agent: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"your key is %s\"},\"finish_reason\":\"stop\"}]}\n\n", secret)
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			},
+		},
+		{
+			name: "error",
+			agent: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "invalid key "+secret, http.StatusUnauthorized)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServerWithOptions(t, tt.agent, Options{Redactor: redactor})
+
+			resp, err := http.Post(server.URL+"/api/chat", "application/json", strings.NewReader(`{"messages":[{"role":"user","content":"hello"}]}`))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.NotContains(t, string(b), secret)
+			assert.Contains(t, string(b), chat.Redacted)
+		})
+	}
+}
+
+func TestServer_Chat_InvalidRequests(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the agent should not be called")
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "wrong_method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "not_json", method: http.MethodPost, contentType: "text/plain", body: "hello", status: http.StatusUnsupportedMediaType},
+		{name: "invalid_json", method: http.MethodPost, contentType: "application/json", body: "{", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+"/api/chat", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tt.contentType)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestServer_Page(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "<title>gh debug-cli</title>")
+}
+
+func TestServer_Origin(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		status int
+	}{
+		{name: "same_origin", origin: server.URL, status: http.StatusOK},
+		{name: "no_origin", status: http.StatusOK},
+		{name: "localhost", host: fmt.Sprintf("localhost:%d", port), status: http.StatusOK},
+		{name: "rebound_domain", host: fmt.Sprintf("attacker.example:%d", port), status: http.StatusForbidden},
+		{name: "other_port", host: "127.0.0.1:1", status: http.StatusForbidden},
+		{name: "cross_origin", origin: "http://attacker.example", status: http.StatusForbidden},
+		{name: "null_origin", origin: "null", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/api/chat", strings.NewReader(`{"messages":[]}`))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestServer_allowedHost(t *testing.T) {
+	tests := []struct {
+		addr    string
+		host    string
+		allowed bool
+	}{
+		{addr: "127.0.0.1:8090", host: "127.0.0.1:8090", allowed: true},
+		{addr: "127.0.0.1:8090", host: "localhost:8090", allowed: true},
+		{addr: "127.0.0.1:8090", host: "[::1]:8090", allowed: true},
+		{addr: "127.0.0.1:8090", host: "127.0.0.1", allowed: false},
+		{addr: "127.0.0.1:8090", host: "192.168.1.5:8090", allowed: false},
+		{addr: "127.0.0.1:8090", host: "attacker.example:8090", allowed: false},
+		{addr: "[::]:8090", host: "192.168.1.5:8090", allowed: true},
+		{addr: "[::]:8090", host: "attacker.example:8090", allowed: false},
+		{addr: "192.168.1.5:8090", host: "192.168.1.5:8090", allowed: true},
+		{addr: "192.168.1.5:8090", host: "localhost:8090", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr+"_"+tt.host, func(t *testing.T) {
+			s := &Server{opts: Options{Addr: tt.addr}}
+			assert.Equal(t, tt.allowed, s.allowedHost(tt.host))
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	_, err := NewServer(Options{})
+	assert.EqualError(t, err, "agent url is required")
+
+	_, err = NewServer(Options{ClientOptions: []chat.ClientOption{chat.WithURL("http://localhost:8080")}})
+	assert.ErrorContains(t, err, `invalid address ""`)
+}